@@ -2,6 +2,9 @@ package fs
 
 import (
 	"io"
+	"os"
+	"reflect"
+	"time"
 )
 
 // Filesystem provides a select set of basic filesystem operations as a
@@ -19,8 +22,25 @@ type Filesystem interface {
 	// resulting paths include the directory prefix. Path names are listed
 	// in lexical order.
 	ListFiles(dirPath string) ([]string, error)
+	// ListDirs lists the subdirectories of a directory, without recurring
+	// down the directory tree. The resulting paths include the directory
+	// prefix. Path names are listed in lexical order.
+	ListDirs(dirPath string) ([]string, error)
 	// Open opens an absolute filepath for reading.
 	Open(path string) (File, error)
+	// Stat describes the file at the given path.
+	Stat(path string) (FileInfo, error)
+
+	// Join joins path elements with the filesystem's separator, as with
+	// filepath.Join.
+	Join(elem ...string) string
+	// Dir returns all but the last element of a path, as with
+	// filepath.Dir.
+	Dir(path string) string
+	// Rel returns a path that is lexically equivalent to targPath when
+	// joined to basePath, as with filepath.Rel. It may fail if targPath is
+	// not under basePath.
+	Rel(basePath string, targPath string) (string, error)
 }
 
 // File wraps the Reader, Seeker, and Closer interfaces.
@@ -29,3 +49,37 @@ type File interface {
 	io.Seeker
 	io.Closer
 }
+
+// FileInfo describes a file, as returned by Filesystem.Stat.
+type FileInfo struct {
+	// Size is the length of the file in bytes.
+	Size int64
+	// ModTime is when the file was last modified.
+	ModTime time.Time
+	// ID identifies the underlying file, so that a file replaced by
+	// another at the same path gets a new ID. It's compared with SameFile,
+	// so it should be an os.FileInfo or comparable with ==; other IDs are
+	// treated like nil. It may be nil if the filesystem can't identify
+	// files.
+	ID interface{}
+}
+
+// SameFile reports whether two FileInfos describe the same underlying file,
+// as opposed to different files that were at the same path at different
+// times. If either ID is nil or can't be compared, it returns true, since
+// there's no evidence otherwise.
+func (fi FileInfo) SameFile(other FileInfo) bool {
+	if fi.ID == nil || other.ID == nil {
+		return true
+	}
+	if a, ok := fi.ID.(os.FileInfo); ok {
+		if b, ok := other.ID.(os.FileInfo); ok {
+			return os.SameFile(a, b)
+		}
+	}
+	at, bt := reflect.TypeOf(fi.ID), reflect.TypeOf(other.ID)
+	if !at.Comparable() || !bt.Comparable() {
+		return true
+	}
+	return fi.ID == other.ID
+}
@@ -0,0 +1,178 @@
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+// defaultGCSEndpoint is the base URL of the Google Cloud Storage JSON API.
+const defaultGCSEndpoint = "https://storage.googleapis.com"
+
+// GCS implements the Filesystem interface for Google Cloud Storage, via its
+// JSON API. Paths are of the form "bucket/object/name": i.e., like "gs://"
+// URLs but without the scheme.
+type GCS struct {
+	// Client is the HTTP client used for all requests. It's optional;
+	// nil means to use http.DefaultClient, which can only read public
+	// buckets. To read private buckets, provide a client whose transport
+	// adds OAuth credentials, like one from golang.org/x/oauth2/google.
+	Client *http.Client
+	// Endpoint is the base URL of the API. It's optional; empty means to
+	// use the public Google Cloud Storage endpoint.
+	Endpoint string
+}
+
+// FindFiles implements Filesystem.FindFiles.
+func (g GCS) FindFiles(dirPath string, basenameGlob string) ([]string, error) {
+	return objectFindFiles(g, dirPath, basenameGlob)
+}
+
+// ListFiles implements Filesystem.ListFiles.
+func (g GCS) ListFiles(dirPath string) ([]string, error) {
+	return objectListFiles(g, dirPath)
+}
+
+// ListDirs implements Filesystem.ListDirs.
+func (g GCS) ListDirs(dirPath string) ([]string, error) {
+	return objectListDirs(g, dirPath)
+}
+
+// Open implements Filesystem.Open.
+func (g GCS) Open(path string) (File, error) {
+	return objectOpen(g, path)
+}
+
+// Stat implements Filesystem.Stat. The ID is the object's generation number,
+// as a decimal string. Objects can't be modified in place, so one that's been
+// rewritten to append to it has a new generation, just as if it were replaced.
+func (g GCS) Stat(path string) (FileInfo, error) {
+	return objectStat(g, path)
+}
+
+// Join implements Filesystem.Join.
+func (GCS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Dir implements Filesystem.Dir.
+func (GCS) Dir(p string) string {
+	return path.Dir(p)
+}
+
+// Rel implements Filesystem.Rel.
+func (GCS) Rel(basePath string, targPath string) (string, error) {
+	return objectRel(basePath, targPath)
+}
+
+func (g GCS) client() *http.Client {
+	if g.Client == nil {
+		return http.DefaultClient
+	}
+	return g.Client
+}
+
+func (g GCS) endpoint() string {
+	if g.Endpoint == "" {
+		return defaultGCSEndpoint
+	}
+	return g.Endpoint
+}
+
+// objectURL returns the URL for the metadata of the given object. Append
+// "?alt=media" to get its contents.
+func (g GCS) objectURL(bucket string, object string) string {
+	return fmt.Sprintf("%s/storage/v1/b/%s/o/%s", g.endpoint(), url.PathEscape(bucket), url.PathEscape(object))
+}
+
+func (g GCS) list(bucket string, prefix string, shallow bool) ([]string, []string, error) {
+	listURL := fmt.Sprintf("%s/storage/v1/b/%s/o", g.endpoint(), url.PathEscape(bucket))
+	var results, dirs []string
+	pageToken := ""
+	for {
+		q := url.Values{}
+		q.Set("prefix", prefix)
+		q.Set("fields", "items(name),prefixes,nextPageToken")
+		if shallow {
+			q.Set("delimiter", "/")
+		}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		res, err := g.client().Get(listURL + "?" + q.Encode())
+		if err != nil {
+			return nil, nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			return nil, nil, httpError(res, "gs://"+bucket)
+		}
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			Prefixes      []string `json:"prefixes"`
+			NextPageToken string   `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("listing gs://%s/%s: %v", bucket, prefix, err)
+		}
+		for _, item := range page.Items {
+			results = append(results, item.Name)
+		}
+		dirs = append(dirs, page.Prefixes...)
+		if page.NextPageToken == "" {
+			return results, dirs, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func (g GCS) get(bucket string, object string, offset int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", g.objectURL(bucket, object)+"?alt=media", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	res, err := g.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return rangeResponse(res, offset, "gs://"+bucket+"/"+object)
+}
+
+func (g GCS) stat(bucket string, object string) (FileInfo, error) {
+	res, err := g.client().Get(g.objectURL(bucket, object) + "?fields=size,updated,generation")
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return FileInfo{}, httpError(res, "gs://"+bucket+"/"+object)
+	}
+	defer res.Body.Close()
+	// The JSON API encodes uint64 values as decimal strings, and times
+	// in RFC 3339 format.
+	var md struct {
+		Size       string    `json:"size"`
+		Updated    time.Time `json:"updated"`
+		Generation string    `json:"generation"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&md); err != nil {
+		return FileInfo{}, fmt.Errorf("reading metadata for gs://%s/%s: %v", bucket, object, err)
+	}
+	size, err := strconv.ParseInt(md.Size, 10, 64)
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("reading metadata for gs://%s/%s: %v", bucket, object, err)
+	}
+	info := FileInfo{Size: size, ModTime: md.Updated}
+	if md.Generation != "" {
+		info.ID = md.Generation
+	}
+	return info, nil
+}
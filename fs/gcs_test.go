@@ -0,0 +1,329 @@
+package fs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeModTime is the modification time of objects in a new fakeObjects. Each
+// append advances an object's modification time by a second, and gives it a
+// new generation number, as it would to a real object rewritten to grow it.
+var fakeModTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// fakeObjects is an in-memory bucket of objects for fake object store
+// servers. Safe for concurrent use.
+type fakeObjects struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	modTimes map[string]time.Time
+	gens     map[string]int64
+	lastGen  int64
+}
+
+func newFakeObjects(objects map[string]string) *fakeObjects {
+	result := &fakeObjects{
+		objects:  make(map[string][]byte),
+		modTimes: make(map[string]time.Time),
+		gens:     make(map[string]int64),
+	}
+	for k, v := range objects {
+		result.objects[k] = []byte(v)
+		result.modTimes[k] = fakeModTime
+		result.lastGen++
+		result.gens[k] = result.lastGen
+	}
+	return result
+}
+
+func (fo *fakeObjects) append(name string, data string) {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+	fo.objects[name] = append(fo.objects[name], data...)
+	if mtime, ok := fo.modTimes[name]; ok {
+		fo.modTimes[name] = mtime.Add(time.Second)
+	} else {
+		fo.modTimes[name] = fakeModTime
+	}
+	fo.lastGen++
+	fo.gens[name] = fo.lastGen
+}
+
+func (fo *fakeObjects) lookup(name string) ([]byte, time.Time, int64, bool) {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+	data, ok := fo.objects[name]
+	return append([]byte{}, data...), fo.modTimes[name], fo.gens[name], ok
+}
+
+// list returns names with the given prefix in lexical order. If shallow, it
+// omits those with a "/" after the prefix, and instead returns the distinct
+// prefixes of such names through that "/", also in lexical order.
+func (fo *fakeObjects) list(prefix string, shallow bool) (names []string, prefixes []string) {
+	fo.mu.Lock()
+	defer fo.mu.Unlock()
+	seen := make(map[string]bool)
+	for k := range fo.objects {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if i := strings.Index(k[len(prefix):], "/"); shallow && i >= 0 {
+			p := k[:len(prefix)+i+1]
+			if !seen[p] {
+				seen[p] = true
+				prefixes = append(prefixes, p)
+			}
+			continue
+		}
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	sort.Strings(prefixes)
+	return names, prefixes
+}
+
+// serveRange writes the object contents with http.ServeContent, which honors
+// Range headers and sets Last-Modified. The ETag is the generation number.
+func (fo *fakeObjects) serveRange(w http.ResponseWriter, r *http.Request, name string) {
+	data, mtime, gen, ok := fo.lookup(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, gen))
+	http.ServeContent(w, r, "", mtime, bytes.NewReader(data))
+}
+
+// fakeGCSPageSize is small so that tests exercise pagination.
+const fakeGCSPageSize = 2
+
+// fakeGCS emulates the subset of the Google Cloud Storage JSON API used by the
+// GCS filesystem, for a single bucket called "mybucket".
+func fakeGCS(t *testing.T, fo *fakeObjects) *httptest.Server {
+	const listPath = "/storage/v1/b/mybucket/o"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == listPath {
+			q := r.URL.Query()
+			names, prefixes := fo.list(q.Get("prefix"), q.Get("delimiter") == "/")
+			start, _ := strconv.Atoi(q.Get("pageToken"))
+			var page struct {
+				Items []struct {
+					Name string `json:"name"`
+				} `json:"items"`
+				Prefixes      []string `json:"prefixes,omitempty"`
+				NextPageToken string   `json:"nextPageToken,omitempty"`
+			}
+			if start == 0 {
+				page.Prefixes = prefixes
+			}
+			for i := start; i < len(names) && i < start+fakeGCSPageSize; i++ {
+				page.Items = append(page.Items, struct {
+					Name string `json:"name"`
+				}{names[i]})
+			}
+			if start+fakeGCSPageSize < len(names) {
+				page.NextPageToken = strconv.Itoa(start + fakeGCSPageSize)
+			}
+			json.NewEncoder(w).Encode(page)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, listPath+"/") {
+			t.Errorf("unexpected request: %v", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, listPath+"/")
+		if r.URL.Query().Get("alt") == "media" {
+			fo.serveRange(w, r, name)
+			return
+		}
+		data, mtime, gen, ok := fo.lookup(name)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"size":       strconv.Itoa(len(data)),
+			"updated":    mtime.Format(time.RFC3339Nano),
+			"generation": strconv.FormatInt(gen, 10),
+		})
+	}))
+}
+
+func TestGCSFilesystemImplementsFS(t *testing.T) {
+	var fs Filesystem
+	fs = GCS{}
+	_ = fs
+}
+
+func TestGCSFindFiles(t *testing.T) {
+	fo := newFakeObjects(map[string]string{
+		"logs/":                    "",
+		"logs/run1/tfevents.1":     "",
+		"logs/run2/tfevents.1":     "",
+		"logs/run2/tfevents.2":     "",
+		"logs/run2/randomfile1":    "",
+		"logs/nonrun/randomfile2":  "",
+		"logs2/run3/tfevents.1":    "",
+		"logs/deep/er/tfevents.99": "",
+	})
+	server := fakeGCS(t, fo)
+	defer server.Close()
+	fs := GCS{Endpoint: server.URL}
+
+	gotFiles, err := fs.FindFiles("mybucket/logs", "*tfevents*")
+	wantFiles := []string{
+		"mybucket/logs/deep/er/tfevents.99",
+		"mybucket/logs/run1/tfevents.1",
+		"mybucket/logs/run2/tfevents.1",
+		"mybucket/logs/run2/tfevents.2",
+	}
+	if err != nil || !reflect.DeepEqual(gotFiles, wantFiles) {
+		t.Errorf(`FindFiles("mybucket/logs", "*tfevents*"): got %v, %v; want %v, %v`, gotFiles, err, wantFiles, nil)
+	}
+
+	pat := "[" // ]
+	if files, err := fs.FindFiles("mybucket/logs", pat); len(files) != 0 || err == nil {
+		t.Errorf("FindFiles(_, %q): got %v, %v; want nil, error", pat, files, err)
+	}
+}
+
+func TestGCSListFiles(t *testing.T) {
+	fo := newFakeObjects(map[string]string{
+		"logs/file1":        "",
+		"logs/file2":        "",
+		"logs/file3":        "",
+		"logs/subdir/file4": "",
+		"logsfile5":         "",
+	})
+	server := fakeGCS(t, fo)
+	defer server.Close()
+	fs := GCS{Endpoint: server.URL}
+
+	gotFiles, err := fs.ListFiles("mybucket/logs")
+	wantFiles := []string{"mybucket/logs/file1", "mybucket/logs/file2", "mybucket/logs/file3"}
+	if err != nil || !reflect.DeepEqual(gotFiles, wantFiles) {
+		t.Errorf(`ListFiles("mybucket/logs"): got %v, %v; want %v, %v`, gotFiles, err, wantFiles, nil)
+	}
+}
+
+func TestGCSListDirs(t *testing.T) {
+	fo := newFakeObjects(map[string]string{
+		"logs/file1":              "",
+		"logs/run1/tfevents.1":    "",
+		"logs/run2/tfevents.1":    "",
+		"logs/run2/deeper/file2":  "",
+		"logs/run3/":              "",
+		"logsfile3":               "",
+		"logs2/run4/tfevents.1":   "",
+		"logs/nonrun/randomfile2": "",
+	})
+	server := fakeGCS(t, fo)
+	defer server.Close()
+	fs := GCS{Endpoint: server.URL}
+
+	gotDirs, err := fs.ListDirs("mybucket/logs")
+	wantDirs := []string{"mybucket/logs/nonrun", "mybucket/logs/run1", "mybucket/logs/run2", "mybucket/logs/run3"}
+	if err != nil || !reflect.DeepEqual(gotDirs, wantDirs) {
+		t.Errorf(`ListDirs("mybucket/logs"): got %v, %v; want %v, %v`, gotDirs, err, wantDirs, nil)
+	}
+	gotDirs, err = fs.ListDirs("mybucket")
+	wantDirs = []string{"mybucket/logs", "mybucket/logs2"}
+	if err != nil || !reflect.DeepEqual(gotDirs, wantDirs) {
+		t.Errorf(`ListDirs("mybucket"): got %v, %v; want %v, %v`, gotDirs, err, wantDirs, nil)
+	}
+}
+
+func TestGCSStat(t *testing.T) {
+	fo := newFakeObjects(map[string]string{"logs/myfile": "hello"})
+	server := fakeGCS(t, fo)
+	defer server.Close()
+	testObjectStat(t, GCS{Endpoint: server.URL}, "mybucket/logs/myfile", func(data string) { fo.append("logs/myfile", data) })
+}
+
+func TestGCSOpen(t *testing.T) {
+	fo := newFakeObjects(map[string]string{"logs/myfile": "hello"})
+	server := fakeGCS(t, fo)
+	defer server.Close()
+	fs := GCS{Endpoint: server.URL}
+
+	if f, err := fs.Open("mybucket/logs/enoent"); !os.IsNotExist(err) {
+		t.Errorf("Open(enoent): got %v, %v; want nil, ENOENT", f, err)
+	}
+	testObjectFile(t, fs, "mybucket/logs/myfile", func(data string) { fo.append("logs/myfile", data) })
+}
+
+// testObjectStat tests statting a file whose initial contents are "hello",
+// modified at fakeModTime. Calling grow appends to the underlying object.
+func testObjectStat(t *testing.T, fs Filesystem, path string, grow func(string)) {
+	info, err := fs.Stat(path)
+	want := FileInfo{Size: 5, ModTime: fakeModTime}
+	if err != nil || info.Size != want.Size || !info.ModTime.Equal(want.ModTime) || info.ID == nil {
+		t.Errorf("Stat(%q): got %+v, %v; want %+v with an ID, nil", path, info, err, want)
+	}
+	if again, err := fs.Stat(path); err != nil || !info.SameFile(again) {
+		t.Errorf("Stat(%q) again: got %+v, %v; want same file as %+v", path, again, err, info)
+	}
+	// Growing an object rewrites it, so it's a new file.
+	grow(", world")
+	grown, err := fs.Stat(path)
+	if err != nil || grown.Size != 12 || !grown.ModTime.After(info.ModTime) || info.SameFile(grown) {
+		t.Errorf("Stat(%q) after growth: got %+v, %v; want size 12, later mod time, different file", path, grown, err)
+	}
+
+	if info, err := fs.Stat(path + "-enoent"); !os.IsNotExist(err) {
+		t.Errorf("Stat(enoent): got %+v, %v; want ENOENT", info, err)
+	}
+	if info, err := fs.Stat("mybucket"); err == nil {
+		t.Errorf("Stat(bucket): got %+v, %v; want error", info, err)
+	}
+}
+
+// testObjectFile tests reading, growing, and seeking a file whose initial
+// contents are "hello". Calling grow appends to the underlying object.
+func testObjectFile(t *testing.T, fs Filesystem, path string, grow func(string)) {
+	f, err := fs.Open(path)
+	if err != nil {
+		t.Fatalf("Open(%q): %v", path, err)
+	}
+	defer f.Close()
+
+	if got, err := ioutil.ReadAll(f); string(got) != "hello" || err != nil {
+		t.Errorf("first read: got %q, %v; want %q, nil", got, err, "hello")
+	}
+	if n, err := f.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("read at EOF: got %v, %v; want 0, EOF", n, err)
+	}
+	grow(", world")
+	if got, err := ioutil.ReadAll(f); string(got) != ", world" || err != nil {
+		t.Errorf("read after growth: got %q, %v; want %q, nil", got, err, ", world")
+	}
+	if n, err := f.Seek(-5, io.SeekEnd); n != 7 || err != nil {
+		t.Errorf("Seek(-5, io.SeekEnd): got %v, %v; want 7, nil", n, err)
+	}
+	if n, err := f.Seek(1, io.SeekCurrent); n != 8 || err != nil {
+		t.Errorf("Seek(1, io.SeekCurrent): got %v, %v; want 8, nil", n, err)
+	}
+	if got, err := ioutil.ReadAll(f); string(got) != "orld" || err != nil {
+		t.Errorf("read after seek: got %q, %v; want %q, nil", got, err, "orld")
+	}
+	if n, err := f.Seek(4, io.SeekStart); n != 4 || err != nil {
+		t.Errorf("Seek(4, io.SeekStart): got %v, %v; want 4, nil", n, err)
+	}
+	buf := make([]byte, 3)
+	if n, err := io.ReadFull(f, buf); string(buf[:n]) != "o, " || err != nil {
+		t.Errorf("partial read after seek: got %q, %v; want %q, nil", buf[:n], err, "o, ")
+	}
+}
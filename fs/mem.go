@@ -0,0 +1,353 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault is the error returned by reads that fail because of a
+// MemFaults.FailRead with no explicit Err.
+var ErrInjectedFault = errors.New("injected read fault")
+
+// Mem implements the Filesystem interface in memory, for tests and for
+// embedding. Paths are "/"-separated, as with the "path" package, and are
+// cleaned before use. Directories exist implicitly as long as they contain
+// files, so there are no empty directories.
+//
+// Files opened with Open observe later appends and truncations, as with a
+// file being written by another process. A file replaced by Create or removed
+// by Delete stays readable through files already open on it.
+//
+// Modification times come from a logical clock that advances by a second on
+// each change to the filesystem, so they're deterministic and strictly
+// increasing. File IDs are generation numbers, unique across files ever
+// created in the Mem.
+//
+// The zero value is an empty filesystem. A Mem is safe for concurrent use, and
+// must not be copied after first use.
+type Mem struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+	// clock counts changes to the filesystem, for modification times and
+	// file generations.
+	clock int64
+}
+
+// MemFaults configures faults injected into reads of a Mem file.
+type MemFaults struct {
+	// FailRead, if positive, makes the FailRead-th Read call on the file
+	// fail, counting from 1 across all open Files for it and including
+	// reads made before the faults were set. Only that one call fails.
+	FailRead int
+	// Err is the error returned by the failing read. It's optional; nil
+	// means to use ErrInjectedFault.
+	Err error
+	// MaxRead, if positive, limits each Read to at most MaxRead bytes.
+	MaxRead int
+}
+
+type memFile struct {
+	data    []byte
+	gen     int64
+	modTime time.Time
+	faults  MemFaults
+	// reads counts Read calls on this file across all open Files.
+	reads int
+}
+
+// memEpoch is the modification time at clock zero.
+var memEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// tick advances the logical clock and returns the new time. Caller must hold
+// m.mu.
+func (m *Mem) tick() time.Time {
+	m.clock++
+	return memEpoch.Add(time.Duration(m.clock) * time.Second)
+}
+
+// lookup finds a file by cleaned path, or returns a PathError for op. Caller
+// must hold m.mu.
+func (m *Mem) lookup(op string, p string) (*memFile, error) {
+	f, ok := m.files[path.Clean(p)]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: p, Err: os.ErrNotExist}
+	}
+	return f, nil
+}
+
+// Create creates an empty file at the given path, replacing any existing file
+// with a new one.
+func (m *Mem) Create(p string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.create(p)
+}
+
+// create implements Create. Caller must hold m.mu.
+func (m *Mem) create(p string) *memFile {
+	if m.files == nil {
+		m.files = make(map[string]*memFile)
+	}
+	now := m.tick()
+	f := &memFile{gen: m.clock, modTime: now}
+	m.files[path.Clean(p)] = f
+	return f
+}
+
+// Append appends data to the file at the given path, creating it if needed.
+func (m *Mem) Append(p string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[path.Clean(p)]
+	if !ok {
+		f = m.create(p)
+	}
+	f.data = append(f.data, data...)
+	f.modTime = m.tick()
+}
+
+// Truncate changes the size of the file at the given path, keeping its
+// identity. Growing a file pads it with zeros.
+func (m *Mem) Truncate(p string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lookup("truncate", p)
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: p, Err: errors.New("negative size")}
+	}
+	if size <= int64(len(f.data)) {
+		// Copy rather than reslice, so that later appends don't
+		// clobber data that a reader might have already seen.
+		f.data = append([]byte(nil), f.data[:size]...)
+	} else {
+		f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	}
+	f.modTime = m.tick()
+	return nil
+}
+
+// Delete removes the file at the given path.
+func (m *Mem) Delete(p string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.lookup("delete", p); err != nil {
+		return err
+	}
+	delete(m.files, path.Clean(p))
+	m.tick()
+	return nil
+}
+
+// SetFaults sets the faults injected into reads of the file at the given path,
+// replacing any previous faults.
+func (m *Mem) SetFaults(p string, faults MemFaults) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lookup("setfaults", p)
+	if err != nil {
+		return err
+	}
+	f.faults = faults
+	return nil
+}
+
+// under returns the files under a directory, as paths relative to it, in
+// lexical order. It fails if there are none. Caller must hold m.mu.
+func (m *Mem) under(op string, dirPath string) ([]string, error) {
+	prefix := path.Clean(dirPath) + "/"
+	if prefix == "//" {
+		prefix = "/"
+	} else if prefix == "./" {
+		prefix = ""
+	}
+	var results []string
+	for p := range m.files {
+		if strings.HasPrefix(p, prefix) {
+			results = append(results, p[len(prefix):])
+		}
+	}
+	if len(results) == 0 {
+		return nil, &os.PathError{Op: op, Path: dirPath, Err: os.ErrNotExist}
+	}
+	sort.Strings(results)
+	return results, nil
+}
+
+// FindFiles implements Filesystem.FindFiles.
+func (m *Mem) FindFiles(dirPath string, basenameGlob string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rels, err := m.under("find", dirPath)
+	if err != nil {
+		return nil, err
+	}
+	var results []string
+	for _, rel := range rels {
+		matched, err := path.Match(basenameGlob, path.Base(rel))
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			results = append(results, path.Join(dirPath, rel))
+		}
+	}
+	return results, nil
+}
+
+// ListFiles implements Filesystem.ListFiles.
+func (m *Mem) ListFiles(dirPath string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rels, err := m.under("list", dirPath)
+	if err != nil {
+		return nil, err
+	}
+	var results []string
+	for _, rel := range rels {
+		if !strings.Contains(rel, "/") {
+			results = append(results, path.Join(dirPath, rel))
+		}
+	}
+	return results, nil
+}
+
+// ListDirs implements Filesystem.ListDirs.
+func (m *Mem) ListDirs(dirPath string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rels, err := m.under("list", dirPath)
+	if err != nil {
+		return nil, err
+	}
+	var results []string
+	for _, rel := range rels {
+		i := strings.Index(rel, "/")
+		if i < 0 {
+			continue
+		}
+		// Sorting puts all files in a subdirectory together.
+		dir := path.Join(dirPath, rel[:i])
+		if len(results) == 0 || results[len(results)-1] != dir {
+			results = append(results, dir)
+		}
+	}
+	return results, nil
+}
+
+// Open implements Filesystem.Open.
+func (m *Mem) Open(p string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lookup("open", p)
+	if err != nil {
+		return nil, err
+	}
+	return &memHandle{m: m, f: f}, nil
+}
+
+// Stat implements Filesystem.Stat. The ID is the file's generation number, an
+// int64.
+func (m *Mem) Stat(p string) (FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := m.lookup("stat", p)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{Size: int64(len(f.data)), ModTime: f.modTime, ID: f.gen}, nil
+}
+
+// Join implements Filesystem.Join.
+func (*Mem) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Dir implements Filesystem.Dir.
+func (*Mem) Dir(p string) string {
+	return path.Dir(p)
+}
+
+// Rel implements Filesystem.Rel. As with object stores, targPath must be under
+// basePath.
+func (*Mem) Rel(basePath string, targPath string) (string, error) {
+	return objectRel(basePath, targPath)
+}
+
+// A memHandle is an open Mem file.
+type memHandle struct {
+	m *Mem
+	f *memFile
+	// offset is the position of the next byte to be read.
+	offset int64
+	closed bool
+}
+
+func (h *memHandle) Read(p []byte) (int, error) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	h.f.reads++
+	faults := h.f.faults
+	if h.f.reads == faults.FailRead {
+		if faults.Err != nil {
+			return 0, faults.Err
+		}
+		return 0, ErrInjectedFault
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if h.offset >= int64(len(h.f.data)) {
+		return 0, io.EOF
+	}
+	if faults.MaxRead > 0 && len(p) > faults.MaxRead {
+		p = p[:faults.MaxRead]
+	}
+	n := copy(p, h.f.data[h.offset:])
+	h.offset += int64(n)
+	return n, nil
+}
+
+func (h *memHandle) Seek(offset int64, whence int) (int64, error) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	if h.closed {
+		return 0, os.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += h.offset
+	case io.SeekEnd:
+		offset += int64(len(h.f.data))
+	default:
+		return 0, fmt.Errorf("seek: invalid whence %v", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek: negative position %v", offset)
+	}
+	h.offset = offset
+	return offset, nil
+}
+
+func (h *memHandle) Close() error {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	if h.closed {
+		return os.ErrClosed
+	}
+	h.closed = true
+	return nil
+}
@@ -0,0 +1,210 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMemFilesystemImplementsFS(t *testing.T) {
+	var fs Filesystem
+	fs = &Mem{}
+	_ = fs
+}
+
+func TestMemListing(t *testing.T) {
+	fs := &Mem{}
+	for _, p := range []string{
+		"logs/run1/tfevents.1",
+		"logs/run2/tfevents.1",
+		"logs/run2/tfevents.2",
+		"logs/run2/randomfile1",
+		"logs/run2/deeper/tfevents.3",
+		"logs/nonrun/randomfile2",
+		"logs/file1",
+		"logs2/run3/tfevents.1",
+		"logsfile",
+	} {
+		fs.Create(p)
+	}
+
+	gotFiles, err := fs.FindFiles("logs", "*tfevents*")
+	wantFiles := []string{
+		"logs/run1/tfevents.1",
+		"logs/run2/deeper/tfevents.3",
+		"logs/run2/tfevents.1",
+		"logs/run2/tfevents.2",
+	}
+	if err != nil || !reflect.DeepEqual(gotFiles, wantFiles) {
+		t.Errorf(`FindFiles("logs", "*tfevents*"): got %v, %v; want %v, %v`, gotFiles, err, wantFiles, nil)
+	}
+	pat := "[" // ]
+	if files, err := fs.FindFiles("logs", pat); len(files) != 0 || err == nil {
+		t.Errorf("FindFiles(_, %q): got %v, %v; want nil, error", pat, files, err)
+	}
+
+	gotFiles, err = fs.ListFiles("logs/run2/")
+	wantFiles = []string{"logs/run2/randomfile1", "logs/run2/tfevents.1", "logs/run2/tfevents.2"}
+	if err != nil || !reflect.DeepEqual(gotFiles, wantFiles) {
+		t.Errorf(`ListFiles("logs/run2/"): got %v, %v; want %v, %v`, gotFiles, err, wantFiles, nil)
+	}
+
+	gotDirs, err := fs.ListDirs("logs")
+	wantDirs := []string{"logs/nonrun", "logs/run1", "logs/run2"}
+	if err != nil || !reflect.DeepEqual(gotDirs, wantDirs) {
+		t.Errorf(`ListDirs("logs"): got %v, %v; want %v, %v`, gotDirs, err, wantDirs, nil)
+	}
+
+	// Deleting the last file in a directory removes the directory.
+	if err := fs.Delete("logs/run1/tfevents.1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if files, err := fs.ListFiles("logs/run1"); len(files) != 0 || !os.IsNotExist(err) {
+		t.Errorf(`ListFiles("logs/run1") after Delete: got %v, %v; want nil, ENOENT`, files, err)
+	}
+	if files, err := fs.FindFiles("enoent", "*"); len(files) != 0 || !os.IsNotExist(err) {
+		t.Errorf(`FindFiles("enoent", "*"): got %v, %v; want nil, ENOENT`, files, err)
+	}
+	if err := fs.Delete("logs/run1/tfevents.1"); !os.IsNotExist(err) {
+		t.Errorf("second Delete: got %v, want ENOENT", err)
+	}
+}
+
+func TestMemOpen(t *testing.T) {
+	fs := &Mem{}
+	fs.Append("logs/myfile", []byte("hello"))
+	if f, err := fs.Open("logs/enoent"); !os.IsNotExist(err) {
+		t.Errorf("Open(enoent): got %v, %v; want nil, ENOENT", f, err)
+	}
+	testObjectFile(t, fs, "logs/myfile", func(data string) { fs.Append("logs/myfile", []byte(data)) })
+}
+
+func TestMemStat(t *testing.T) {
+	fs := &Mem{}
+	fs.Append("logs/myfile", []byte("hello"))
+	info, err := fs.Stat("logs/myfile")
+	if err != nil || info.Size != 5 || info.ID == nil {
+		t.Fatalf("Stat: got %+v, %v; want size 5 with an ID", info, err)
+	}
+
+	fs.Append("logs/myfile", []byte(", world"))
+	appended, err := fs.Stat("logs/myfile")
+	if err != nil || appended.Size != 12 || !appended.ModTime.After(info.ModTime) || !info.SameFile(appended) {
+		t.Errorf("Stat after append: got %+v, %v; want size 12, later mod time, same file as %+v", appended, err, info)
+	}
+
+	if err := fs.Truncate("logs/myfile", 2); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	truncated, err := fs.Stat("logs/myfile")
+	if err != nil || truncated.Size != 2 || !info.SameFile(truncated) {
+		t.Errorf("Stat after truncate: got %+v, %v; want size 2, same file as %+v", truncated, err, info)
+	}
+
+	fs.Create("logs/myfile")
+	replaced, err := fs.Stat("logs/myfile")
+	if err != nil || replaced.Size != 0 || info.SameFile(replaced) {
+		t.Errorf("Stat after Create: got %+v, %v; want size 0, different file from %+v", replaced, err, info)
+	}
+
+	if info, err := fs.Stat("logs"); !os.IsNotExist(err) {
+		t.Errorf("Stat(dir): got %+v, %v; want ENOENT", info, err)
+	}
+	if err := fs.Truncate("logs/enoent", 0); !os.IsNotExist(err) {
+		t.Errorf("Truncate(enoent): got %v, want ENOENT", err)
+	}
+}
+
+func TestMemOpenFileOutlivesReplacement(t *testing.T) {
+	fs := &Mem{}
+	fs.Append("myfile", []byte("hello"))
+	f, err := fs.Open("myfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Truncation is visible to open files...
+	if err := fs.Truncate("myfile", 4); err != nil {
+		t.Fatal(err)
+	}
+	fs.Append("myfile", []byte("!"))
+	if got, err := ioutil.ReadAll(f); string(got) != "hell!" || err != nil {
+		t.Errorf("read after truncate: got %q, %v; want %q, nil", got, err, "hell!")
+	}
+
+	// ...but replacement and deletion aren't.
+	fs.Create("myfile")
+	fs.Append("myfile", []byte("other"))
+	if err := fs.Delete("myfile"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(f); string(got) != "hell!" || err != nil {
+		t.Errorf("read after replace: got %q, %v; want %q, nil", got, err, "hell!")
+	}
+
+	if err := f.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if n, err := f.Read(make([]byte, 1)); n != 0 || err == nil {
+		t.Errorf("Read after Close: got %v, %v; want 0, error", n, err)
+	}
+}
+
+func TestMemFaults(t *testing.T) {
+	fs := &Mem{}
+	fs.Append("myfile", []byte("hello, world"))
+	if err := fs.SetFaults("myfile", MemFaults{FailRead: 3, MaxRead: 5}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Open("myfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 100)
+	reads := []struct {
+		data string
+		err  error
+	}{
+		{"hello", nil},
+		{", wor", nil},
+		{"", ErrInjectedFault},
+		{"ld", nil},
+		{"", io.EOF},
+	}
+	for i, want := range reads {
+		n, err := f.Read(buf)
+		if string(buf[:n]) != want.data || err != want.err {
+			t.Errorf("read %v: got %q, %v; want %q, %v", i+1, buf[:n], err, want.data, want.err)
+		}
+	}
+
+	// Read counts persist across files, and custom errors are honored.
+	errBoom := errors.New("boom")
+	if err := fs.SetFaults("myfile", MemFaults{FailRead: 7, Err: errBoom}); err != nil {
+		t.Fatal(err)
+	}
+	g, err := fs.Open("myfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if n, err := g.Read(buf); string(buf[:n]) != "hello, world" || err != nil {
+		t.Errorf("read 6: got %q, %v; want %q, nil", buf[:n], err, "hello, world")
+	}
+	if n, err := g.Read(buf); n != 0 || err != errBoom {
+		t.Errorf("read 7: got %v, %v; want 0, %v", n, err, errBoom)
+	}
+
+	if err := fs.SetFaults("enoent", MemFaults{}); !os.IsNotExist(err) {
+		t.Errorf("SetFaults(enoent): got %v, want ENOENT", err)
+	}
+}
@@ -0,0 +1,328 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// An objectStore is a flat namespace of objects grouped into buckets, like a
+// cloud storage service. Paths under a Filesystem backed by an objectStore
+// are of the form "bucket/object/name", with no URL scheme.
+type objectStore interface {
+	// list lists the names of all objects in the bucket whose names start
+	// with prefix. If shallow is true, objects whose names contain a "/"
+	// after the prefix are omitted, and instead the second result lists
+	// each distinct prefix of their names through that "/", like
+	// "prefix/subdir/".
+	list(bucket string, prefix string, shallow bool) (objects []string, dirs []string, err error)
+	// get opens a stream of the contents of an object, starting from the
+	// given byte offset. It returns io.EOF if the offset is at or past the
+	// end of the object.
+	get(bucket string, object string, offset int64) (io.ReadCloser, error)
+	// stat describes an object. Its ID identifies the object's current
+	// version, like a GCS generation or an S3 ETag. Since objects are
+	// replaced whole whenever they change, it changes even when an
+	// object only grows.
+	stat(bucket string, object string) (FileInfo, error)
+}
+
+// splitObjectPath splits a path like "bucket/object/name" into its bucket and
+// object name. The object name may be empty.
+func splitObjectPath(p string) (bucket string, object string, err error) {
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return "", "", fmt.Errorf("object path %q has no bucket", p)
+	}
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		return p[:i], p[i+1:], nil
+	}
+	return p, "", nil
+}
+
+// dirPrefix returns the object name prefix for all objects under the given
+// directory-like object name.
+func dirPrefix(object string) string {
+	object = strings.TrimSuffix(object, "/")
+	if object == "" {
+		return ""
+	}
+	return object + "/"
+}
+
+func objectFindFiles(st objectStore, dirPath string, basenameGlob string) ([]string, error) {
+	bucket, object, err := splitObjectPath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	// Validate the pattern even if there are no objects to match against.
+	if _, err := path.Match(basenameGlob, ""); err != nil {
+		return nil, err
+	}
+	names, _, err := st.list(bucket, dirPrefix(object), false)
+	if err != nil {
+		return nil, err
+	}
+	var results []string
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue // directory placeholder
+		}
+		if matched, _ := path.Match(basenameGlob, path.Base(name)); matched {
+			results = append(results, bucket+"/"+name)
+		}
+	}
+	sort.Strings(results)
+	return results, nil
+}
+
+func objectListFiles(st objectStore, dirPath string) ([]string, error) {
+	bucket, object, err := splitObjectPath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	names, _, err := st.list(bucket, dirPrefix(object), true)
+	if err != nil {
+		return nil, err
+	}
+	var results []string
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			continue // directory placeholder
+		}
+		results = append(results, bucket+"/"+name)
+	}
+	sort.Strings(results)
+	return results, nil
+}
+
+func objectListDirs(st objectStore, dirPath string) ([]string, error) {
+	bucket, object, err := splitObjectPath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	_, dirs, err := st.list(bucket, dirPrefix(object), true)
+	if err != nil {
+		return nil, err
+	}
+	var results []string
+	for _, dir := range dirs {
+		results = append(results, bucket+"/"+strings.TrimSuffix(dir, "/"))
+	}
+	sort.Strings(results)
+	return results, nil
+}
+
+func objectOpen(st objectStore, p string) (File, error) {
+	bucket, object, err := splitObjectPath(p)
+	if err != nil {
+		return nil, err
+	}
+	if object == "" {
+		return nil, &os.PathError{Op: "open", Path: p, Err: errors.New("is a bucket")}
+	}
+	if _, err := st.stat(bucket, object); err != nil {
+		return nil, err
+	}
+	return &objectFile{st: st, bucket: bucket, object: object}, nil
+}
+
+func objectStat(st objectStore, p string) (FileInfo, error) {
+	bucket, object, err := splitObjectPath(p)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if object == "" {
+		return FileInfo{}, &os.PathError{Op: "stat", Path: p, Err: errors.New("is a bucket")}
+	}
+	return st.stat(bucket, object)
+}
+
+// objectRel implements Filesystem.Rel for object paths, which have no
+// parent directory references, so targPath must be under basePath.
+func objectRel(basePath string, targPath string) (string, error) {
+	base := path.Clean("/" + basePath)
+	targ := path.Clean("/" + targPath)
+	if targ == base {
+		return ".", nil
+	}
+	prefix := base
+	if prefix != "/" {
+		prefix += "/"
+	}
+	if !strings.HasPrefix(targ, prefix) {
+		return "", fmt.Errorf("Rel: %q is not under %q", targPath, basePath)
+	}
+	return targ[len(prefix):], nil
+}
+
+// An objectFile implements File by issuing ranged reads against an object
+// store. Each Read continues from the end of the previous one, so if the
+// object grows after a Read returns io.EOF then the next Read sees the new
+// data, as with a local file.
+type objectFile struct {
+	st     objectStore
+	bucket string
+	object string
+	// offset is the position of the next byte to be read.
+	offset int64
+	// body is the open response stream starting at offset, or nil if no
+	// request is in flight.
+	body io.ReadCloser
+}
+
+// maxReadAttempts is how many times objectFile.Read tries to read before
+// giving up on a transient error.
+const maxReadAttempts = 5
+
+// readRetryDelay is the delay before the first retry of a read. Each later
+// retry waits twice as long as the one before. It's a variable for tests.
+var readRetryDelay = 100 * time.Millisecond
+
+// Read implements io.Reader. Transient failures, like a connection reset or a
+// 503 response, are retried with backoff, resuming from the current offset.
+func (f *objectFile) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	delay := readRetryDelay
+	for attempt := 1; ; attempt++ {
+		n, err := f.read(p)
+		if err == nil || err == io.EOF || !transient(err) {
+			return n, err
+		}
+		if n > 0 {
+			// Return what we have; the next read reconnects.
+			return n, nil
+		}
+		if attempt == maxReadAttempts {
+			return 0, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// read makes a single attempt to read from the current offset.
+func (f *objectFile) read(p []byte) (int, error) {
+	if f.body == nil {
+		body, err := f.st.get(f.bucket, f.object, f.offset)
+		if err != nil {
+			return 0, err
+		}
+		f.body = body
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	if err != nil {
+		// Start a new request on the next read, whether to retry after
+		// a failure or to pick up data appended after EOF.
+		f.body.Close()
+		f.body = nil
+	}
+	return n, err
+}
+
+func (f *objectFile) Seek(offset int64, whence int) (int64, error) {
+	var base int64
+	switch whence {
+	case io.SeekStart:
+		base = 0
+	case io.SeekCurrent:
+		base = f.offset
+	case io.SeekEnd:
+		info, err := f.st.stat(f.bucket, f.object)
+		if err != nil {
+			return 0, err
+		}
+		base = info.Size
+	default:
+		return 0, fmt.Errorf("seek: invalid whence %v", whence)
+	}
+	if base+offset < 0 {
+		return 0, fmt.Errorf("seek: negative position %v", base+offset)
+	}
+	if f.body != nil && base+offset != f.offset {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = base + offset
+	return f.offset, nil
+}
+
+func (f *objectFile) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
+
+// rangeResponse interprets the response to a GET request for the bytes of an
+// object starting at offset, closing the response body unless it is returned.
+func rangeResponse(res *http.Response, offset int64, what string) (io.ReadCloser, error) {
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		return res.Body, nil
+	case http.StatusOK:
+		if offset != 0 {
+			res.Body.Close()
+			return nil, fmt.Errorf("%s: server ignored range request at offset %d", what, offset)
+		}
+		return res.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		res.Body.Close()
+		return nil, io.EOF
+	default:
+		return nil, httpError(res, what)
+	}
+}
+
+// httpError creates an error describing a failed response, and closes the
+// response body. A 404 response yields an error satisfying os.IsNotExist;
+// others yield a *statusError.
+func httpError(res *http.Response, what string) error {
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return &os.PathError{Op: "open", Path: what, Err: os.ErrNotExist}
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return &statusError{what: what, code: res.StatusCode, status: res.Status, msg: strings.TrimSpace(string(msg))}
+}
+
+// A statusError describes an unsuccessful HTTP response.
+type statusError struct {
+	what   string
+	code   int
+	status string
+	msg    string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.what, e.status, e.msg)
+}
+
+// transient tests whether an error from reading an object may succeed if
+// retried: a 429 or 5xx response, a timeout, or a connection that was reset
+// or cut short.
+func transient(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code == http.StatusTooManyRequests || se.code >= 500
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,106 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyStore is an objectStore holding a single object, whose reads fail
+// according to a script.
+type flakyStore struct {
+	data []byte
+	// getErrs are returned by successive calls to get, until exhausted.
+	getErrs []error
+	// cutAfter, if positive, is the number of bytes after which the next
+	// response body fails with a connection reset. It's reset to zero
+	// once used.
+	cutAfter int
+	// gets counts calls to get.
+	gets int
+}
+
+func (s *flakyStore) list(bucket string, prefix string, shallow bool) ([]string, []string, error) {
+	return []string{"obj"}, nil, nil
+}
+
+func (s *flakyStore) get(bucket string, object string, offset int64) (io.ReadCloser, error) {
+	s.gets++
+	if len(s.getErrs) > 0 {
+		err := s.getErrs[0]
+		s.getErrs = s.getErrs[1:]
+		return nil, err
+	}
+	if offset >= int64(len(s.data)) {
+		return nil, io.EOF
+	}
+	var r io.Reader = bytes.NewReader(s.data[offset:])
+	if s.cutAfter > 0 {
+		r = io.MultiReader(io.LimitReader(r, int64(s.cutAfter)), errReader{syscall.ECONNRESET})
+		s.cutAfter = 0
+	}
+	return ioutil.NopCloser(r), nil
+}
+
+func (s *flakyStore) stat(bucket string, object string) (FileInfo, error) {
+	return FileInfo{Size: int64(len(s.data))}, nil
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read(p []byte) (int, error) { return 0, r.err }
+
+func TestObjectFileRetriesTransientErrors(t *testing.T) {
+	defer func(d time.Duration) { readRetryDelay = d }(readRetryDelay)
+	readRetryDelay = 0
+	st := &flakyStore{
+		data: []byte("hello, world"),
+		getErrs: []error{
+			&statusError{what: "gs://b/obj", code: http.StatusServiceUnavailable, status: "503 Service Unavailable"},
+			&statusError{what: "gs://b/obj", code: http.StatusTooManyRequests, status: "429 Too Many Requests"},
+		},
+		cutAfter: 5,
+	}
+	f := &objectFile{st: st, bucket: "b", object: "obj"}
+	got, err := ioutil.ReadAll(f)
+	if string(got) != "hello, world" || err != nil {
+		t.Errorf("ReadAll: got %q, %v; want %q, nil", got, err, "hello, world")
+	}
+	// Two failed gets, one cut short, and one resuming at offset 5.
+	if st.gets != 4 {
+		t.Errorf("gets: got %v, want 4", st.gets)
+	}
+}
+
+func TestObjectFilePermanentErrors(t *testing.T) {
+	defer func(d time.Duration) { readRetryDelay = d }(readRetryDelay)
+	readRetryDelay = 0
+	forbidden := &statusError{what: "gs://b/obj", code: http.StatusForbidden, status: "403 Forbidden"}
+	st := &flakyStore{data: []byte("hello"), getErrs: []error{forbidden}}
+	f := &objectFile{st: st, bucket: "b", object: "obj"}
+	if n, err := f.Read(make([]byte, 5)); n != 0 || err != forbidden {
+		t.Errorf("Read: got %v, %v; want 0, %v", n, err, forbidden)
+	}
+	if st.gets != 1 {
+		t.Errorf("gets: got %v, want 1 (no retries)", st.gets)
+	}
+
+	// Transient errors are retried only so many times.
+	unavailable := &statusError{what: "gs://b/obj", code: http.StatusServiceUnavailable, status: "503 Service Unavailable"}
+	st = &flakyStore{data: []byte("hello")}
+	for i := 0; i < maxReadAttempts; i++ {
+		st.getErrs = append(st.getErrs, unavailable)
+	}
+	f = &objectFile{st: st, bucket: "b", object: "obj"}
+	if n, err := f.Read(make([]byte, 5)); n != 0 || err != unavailable {
+		t.Errorf("Read after %v failures: got %v, %v; want 0, %v", maxReadAttempts, n, err, unavailable)
+	}
+	// A later read tries again from the same offset.
+	if got, err := ioutil.ReadAll(f); string(got) != "hello" || err != nil {
+		t.Errorf("ReadAll after failure: got %q, %v; want %q, nil", got, err, "hello")
+	}
+}
@@ -13,9 +13,7 @@ type OS struct{}
 // FindFiles implements Filesystem.FindFiles.
 func (OS) FindFiles(dirPath string, basenameGlob string) ([]string, error) {
 	var results []string
-	// Use Walk rather than Glob since Glob doesn't support escaping on
-	// Windows and thus we can't safely embed the dirPath into a pattern.
-	err := filepath.Walk(dirPath, func(filePath string, info os.FileInfo, err error) error {
+	visit := func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -30,8 +28,10 @@ func (OS) FindFiles(dirPath string, basenameGlob string) ([]string, error) {
 			results = append(results, filePath)
 		}
 		return nil
-	})
-	if err != nil {
+	}
+	// Use Walk rather than Glob since Glob doesn't support escaping on
+	// Windows and thus we can't safely embed the dirPath into a pattern.
+	if err := filepath.Walk(dirPath, visit); err != nil {
 		return nil, err
 	}
 	return results, nil
@@ -57,7 +57,53 @@ func (OS) ListFiles(dirPath string) ([]string, error) {
 	return result, nil
 }
 
+// ListDirs implements Filesystem.ListDirs.
+func (OS) ListDirs(dirPath string) ([]string, error) {
+	f, err := os.Open(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	infos, err := f.Readdir(0)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, info := range infos {
+		if info.IsDir() {
+			result = append(result, filepath.Join(dirPath, info.Name()))
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
 // Open implements Filesystem.Open.
 func (OS) Open(path string) (File, error) {
 	return os.Open(path)
 }
+
+// Stat implements Filesystem.Stat. The ID is the os.FileInfo, which identifies
+// the file by device and inode number on Unix systems.
+func (OS) Stat(path string) (FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{Size: info.Size(), ModTime: info.ModTime(), ID: info}, nil
+}
+
+// Join implements Filesystem.Join.
+func (OS) Join(elem ...string) string {
+	return filepath.Join(elem...)
+}
+
+// Dir implements Filesystem.Dir.
+func (OS) Dir(path string) string {
+	return filepath.Dir(path)
+}
+
+// Rel implements Filesystem.Rel.
+func (OS) Rel(basePath string, targPath string) (string, error) {
+	return filepath.Rel(basePath, targPath)
+}
@@ -115,6 +115,72 @@ func TestOSListFilesOSError(t *testing.T) {
 	}
 }
 
+func TestOSListDirs(t *testing.T) {
+	dir := tempdir(t)
+	defer os.RemoveAll(dir)
+
+	logdir := filepath.Join(dir, "logs")
+	mkdirHard(t, filepath.Join(logdir))
+	mkdirHard(t, filepath.Join(logdir, "subdir2"))
+	mkdirHard(t, filepath.Join(logdir, "subdir1"))
+	mkdirHard(t, filepath.Join(logdir, "subdir1", "deeper"))
+	touchHard(t, filepath.Join(logdir, "file1"))
+
+	gotDirs, err := OS{}.ListDirs(logdir)
+	wantDirs := []string{
+		filepath.Join(logdir, "subdir1"),
+		filepath.Join(logdir, "subdir2"),
+	}
+	if err != nil || !reflect.DeepEqual(gotDirs, wantDirs) {
+		t.Errorf("ListDirs(%q): got %v, %v; want %v, %v", logdir, gotDirs, err, wantDirs, nil)
+	}
+
+	nondir := filepath.Join(dir, "enoent")
+	if dirs, err := (OS{}).ListDirs(nondir); len(dirs) != 0 || !os.IsNotExist(err) {
+		t.Errorf("ListDirs(%q): got %v, %v; want nil, ENOENT", nondir, dirs, err)
+	}
+}
+
+func TestPathHelpers(t *testing.T) {
+	for _, fs := range []Filesystem{GCS{}, S3{}} {
+		if got, want := fs.Join("bucket/logs", "run1", "tfevents.1"), "bucket/logs/run1/tfevents.1"; got != want {
+			t.Errorf("%T.Join: got %q, want %q", fs, got, want)
+		}
+		if got, want := fs.Dir("bucket/logs/run1/tfevents.1"), "bucket/logs/run1"; got != want {
+			t.Errorf("%T.Dir: got %q, want %q", fs, got, want)
+		}
+		rels := []struct {
+			base, targ, want string
+		}{
+			{"bucket/logs", "bucket/logs/run1/x", "run1/x"},
+			{"bucket/logs/", "bucket/logs/run1", "run1"},
+			{"bucket/logs", "bucket/logs", "."},
+			{"bucket", "bucket/logs", "logs"},
+		}
+		for _, r := range rels {
+			if got, err := fs.Rel(r.base, r.targ); got != r.want || err != nil {
+				t.Errorf("%T.Rel(%q, %q): got %q, %v; want %q, nil", fs, r.base, r.targ, got, err, r.want)
+			}
+		}
+		for _, targ := range []string{"bucket/logs2/run1", "bucket", "other/logs/run1"} {
+			if got, err := fs.Rel("bucket/logs", targ); err == nil {
+				t.Errorf("%T.Rel(%q, %q): got %q, nil; want error", fs, "bucket/logs", targ, got)
+			}
+		}
+	}
+
+	osfs := OS{}
+	if got, want := osfs.Join("logs", "run1"), filepath.Join("logs", "run1"); got != want {
+		t.Errorf("OS.Join: got %q, want %q", got, want)
+	}
+	if got, want := osfs.Dir(filepath.Join("logs", "run1", "x")), filepath.Join("logs", "run1"); got != want {
+		t.Errorf("OS.Dir: got %q, want %q", got, want)
+	}
+	if got, err := osfs.Rel("logs", filepath.Join("logs", "run1")); got != "run1" || err != nil {
+		t.Errorf("OS.Rel: got %q, %v; want %q, nil", got, err, "run1")
+	}
+}
+
 func TestOSOpenSuccess(t *testing.T) {
 	dir := tempdir(t)
 	defer os.RemoveAll(dir)
@@ -171,6 +237,81 @@ func TestOSOpenOSError(t *testing.T) {
 	}
 }
 
+func TestOSStat(t *testing.T) {
+	dir := tempdir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "myfile")
+	if err := ioutil.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := OS{}.Stat(path)
+	if err != nil {
+		t.Fatalf("OS{}.Stat(%q): %v", path, err)
+	}
+	if info.Size != 5 || info.ModTime.IsZero() {
+		t.Errorf("OS{}.Stat(%q): got %+v, want size 5 and a mod time", path, info)
+	}
+
+	// Appending keeps the same file...
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(", world"))
+	f.Close()
+	appended, err := OS{}.Stat(path)
+	if err != nil {
+		t.Fatalf("OS{}.Stat(%q) after append: %v", path, err)
+	}
+	if appended.Size != 12 || !info.SameFile(appended) {
+		t.Errorf("after append: got %+v, want size 12 and same file as %+v", appended, info)
+	}
+
+	// ...but replacing it doesn't.
+	other := filepath.Join(dir, "other")
+	if err := ioutil.WriteFile(other, []byte("hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(other, path); err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := OS{}.Stat(path)
+	if err != nil {
+		t.Fatalf("OS{}.Stat(%q) after replace: %v", path, err)
+	}
+	if replaced.Size != 2 || info.SameFile(replaced) {
+		t.Errorf("after replace: got %+v, want size 2 and different file from %+v", replaced, info)
+	}
+}
+
+func TestOSStatOSError(t *testing.T) {
+	dir := tempdir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "enoent")
+	if info, err := (OS{}).Stat(path); !os.IsNotExist(err) {
+		t.Errorf("OS{}.Stat(%q): got %+v, %v; want ENOENT", path, info, err)
+	}
+}
+
+func TestFileInfoSameFileUnknown(t *testing.T) {
+	a := FileInfo{Size: 1, ID: "gen1"}
+	if !a.SameFile(FileInfo{Size: 2}) {
+		t.Errorf("SameFile with nil ID: got false, want true")
+	}
+	if a.SameFile(FileInfo{ID: "gen2"}) {
+		t.Errorf("SameFile with different IDs: got true, want false")
+	}
+	if !a.SameFile(FileInfo{ID: "gen1"}) {
+		t.Errorf("SameFile with equal IDs: got false, want true")
+	}
+	b := FileInfo{ID: []byte("gen1")}
+	if !b.SameFile(FileInfo{ID: []byte("gen2")}) {
+		t.Errorf("SameFile with incomparable IDs: got false, want true")
+	}
+}
+
 func tempdir(t *testing.T) string {
 	name, err := ioutil.TempDir("", "fs_os_test")
 	if err != nil {
@@ -0,0 +1,344 @@
+package fs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultS3Region is the AWS region used when S3.Region is empty.
+const defaultS3Region = "us-east-1"
+
+// S3 implements the Filesystem interface for Amazon S3 and compatible object
+// stores, via the REST API with path-style bucket addressing. Paths are of the
+// form "bucket/object/name": i.e., like "s3://" URLs but without the scheme.
+type S3 struct {
+	// Client is the HTTP client used for all requests. It's optional; nil
+	// means to use http.DefaultClient.
+	Client *http.Client
+	// Endpoint is the base URL of the API, like "https://host:port". It's
+	// optional; empty means to use the AWS endpoint for Region.
+	Endpoint string
+	// Region is the AWS region of the buckets, used for the default
+	// endpoint and for request signing. It's optional; empty means
+	// "us-east-1".
+	Region string
+	// Credentials are used to sign requests. It's optional; nil means to
+	// send anonymous requests, which can only read public buckets.
+	Credentials *S3Credentials
+}
+
+// S3Credentials holds AWS credentials for signing S3 requests.
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is optional, and only needed for temporary
+	// credentials.
+	SessionToken string
+}
+
+// FindFiles implements Filesystem.FindFiles.
+func (s S3) FindFiles(dirPath string, basenameGlob string) ([]string, error) {
+	return objectFindFiles(s, dirPath, basenameGlob)
+}
+
+// ListFiles implements Filesystem.ListFiles.
+func (s S3) ListFiles(dirPath string) ([]string, error) {
+	return objectListFiles(s, dirPath)
+}
+
+// ListDirs implements Filesystem.ListDirs.
+func (s S3) ListDirs(dirPath string) ([]string, error) {
+	return objectListDirs(s, dirPath)
+}
+
+// Open implements Filesystem.Open.
+func (s S3) Open(path string) (File, error) {
+	return objectOpen(s, path)
+}
+
+// Stat implements Filesystem.Stat. The ID is the object's ETag, or nil if the
+// store doesn't send one. Objects can't be modified in place, so one that's
+// been rewritten to append to it has a new ETag, just as if it were replaced.
+func (s S3) Stat(path string) (FileInfo, error) {
+	return objectStat(s, path)
+}
+
+// Join implements Filesystem.Join.
+func (S3) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Dir implements Filesystem.Dir.
+func (S3) Dir(p string) string {
+	return path.Dir(p)
+}
+
+// Rel implements Filesystem.Rel.
+func (S3) Rel(basePath string, targPath string) (string, error) {
+	return objectRel(basePath, targPath)
+}
+
+func (s S3) client() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+func (s S3) region() string {
+	if s.Region == "" {
+		return defaultS3Region
+	}
+	return s.Region
+}
+
+func (s S3) endpoint() string {
+	if s.Endpoint == "" {
+		return fmt.Sprintf("https://s3.%s.amazonaws.com", s.region())
+	}
+	return s.Endpoint
+}
+
+// do sends a request for the given bucket and object, which may be empty.
+func (s S3) do(method string, bucket string, object string, query url.Values, header http.Header) (*http.Response, error) {
+	u, err := url.Parse(s.endpoint())
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + bucket
+	u.RawPath = "/" + awsURIEncode(bucket, true)
+	if object != "" {
+		u.Path += "/" + object
+		u.RawPath += "/" + awsURIEncode(object, false)
+	}
+	u.RawQuery = awsCanonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	if s.Credentials != nil {
+		s.sign(req, time.Now().UTC())
+	}
+	return s.client().Do(req)
+}
+
+func (s S3) list(bucket string, prefix string, shallow bool) ([]string, []string, error) {
+	var results, dirs []string
+	token := ""
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", prefix)
+		if shallow {
+			q.Set("delimiter", "/")
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		res, err := s.do("GET", bucket, "", q, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			return nil, nil, httpError(res, "s3://"+bucket)
+		}
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			CommonPrefixes []struct {
+				Prefix string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("listing s3://%s/%s: %v", bucket, prefix, err)
+		}
+		for _, c := range page.Contents {
+			results = append(results, c.Key)
+		}
+		for _, p := range page.CommonPrefixes {
+			dirs = append(dirs, p.Prefix)
+		}
+		if !page.IsTruncated {
+			return results, dirs, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+func (s S3) get(bucket string, object string, offset int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	res, err := s.do("GET", bucket, object, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	return rangeResponse(res, offset, "s3://"+bucket+"/"+object)
+}
+
+func (s S3) stat(bucket string, object string) (FileInfo, error) {
+	res, err := s.do("HEAD", bucket, object, nil, nil)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return FileInfo{}, httpError(res, "s3://"+bucket+"/"+object)
+	}
+	res.Body.Close()
+	if res.ContentLength < 0 {
+		return FileInfo{}, fmt.Errorf("s3://%s/%s: no content length", bucket, object)
+	}
+	info := FileInfo{Size: res.ContentLength}
+	if etag := res.Header.Get("ETag"); etag != "" {
+		info.ID = etag
+	}
+	// Some S3-compatible stores omit Last-Modified; leave a zero mtime.
+	if lm := res.Header.Get("Last-Modified"); lm != "" {
+		t, err := http.ParseTime(lm)
+		if err != nil {
+			return FileInfo{}, fmt.Errorf("s3://%s/%s: bad Last-Modified: %v", bucket, object, err)
+		}
+		info.ModTime = t
+	}
+	return info, nil
+}
+
+// emptySHA256 is the hex-encoded SHA-256 digest of an empty payload.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds AWS Signature Version 4 headers to a request with an empty body.
+// See: https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (s S3) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	if s.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.Credentials.SessionToken)
+	}
+
+	canonicalRequest, signedHeaders := awsCanonicalRequest(req)
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.region())
+	stringToSign := awsStringToSign(amzDate, scope, canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+s.Credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, s.region())
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.Credentials.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+// awsCanonicalRequest returns the SigV4 canonical request for a request with
+// an empty body, along with its semicolon-separated list of signed headers.
+// The host and every header already set on the request are signed, so the
+// request's query string must already be in canonical form.
+func awsCanonicalRequest(req *http.Request) (string, string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for k, vs := range req.Header {
+		k = strings.ToLower(k)
+		if k == "authorization" {
+			continue
+		}
+		headers[k] = strings.TrimSpace(strings.Join(vs, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+	return canonicalRequest, signedHeaders
+}
+
+// awsStringToSign returns the SigV4 string to sign for a canonical request
+// with the given timestamp and credential scope.
+func awsStringToSign(amzDate string, scope string, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	return strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsURIEncode percent-encodes all bytes of s other than unreserved
+// characters, as AWS request signing requires. Slashes are encoded only if
+// encodeSlash is true.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// awsCanonicalQuery encodes a query string with sorted keys and AWS-style
+// percent-encoding, so that it may be used both on the wire and in a
+// canonical request for signing.
+func awsCanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string{}, q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
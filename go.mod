@@ -4,8 +4,10 @@ go 1.15
 
 require (
 	github.com/golang/protobuf v1.4.2
+	github.com/prometheus/client_golang v1.7.1
 	github.com/tensorflow/tensorflow v0.0.0-00010101000000-000000000000
 	github.com/wchargin/tensorboard-data-server/proto v0.0.0-00010101000000-000000000000
+	golang.org/x/oauth2 v0.0.0-20200902213428-5d25da1a8d43
 	google.golang.org/grpc v1.32.0
 	google.golang.org/grpc/cmd/protoc-gen-go-grpc v1.0.0 // indirect
 	google.golang.org/protobuf v1.25.0
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -61,7 +62,7 @@ func readLogDirectory(dir string, poll bool) {
 	for {
 		c := make(chan struct{})
 		go func() {
-			ll.Reload()
+			ll.Reload(context.Background())
 			close(c)
 		}()
 		<-c
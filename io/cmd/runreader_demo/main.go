@@ -20,7 +20,7 @@ func main() {
 	}
 	rundir := os.Args[1]
 	rr := run.ReaderBuilder{FS: fs.OS{}, Dir: rundir}.Start()
-	acc := run.NewAccumulator(rr)
+	acc := run.NewAccumulator(rr, nil)
 	stdin := bufio.NewReader(os.Stdin)
 	counts := make(map[string]int)
 	for {
@@ -0,0 +1,302 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Compression is a compression format for TFRecord files, as with
+// TensorFlow's TFRecordOptions.
+type Compression int
+
+const (
+	// NoCompression is for plain TFRecord files.
+	NoCompression Compression = iota
+	// GzipCompression is for files compressed with gzip (RFC 1952).
+	GzipCompression
+	// ZlibCompression is for files compressed with zlib (RFC 1950).
+	ZlibCompression
+)
+
+// String returns the TFRecordOptions name for a compression format.
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "NONE"
+	case GzipCompression:
+		return "GZIP"
+	case ZlibCompression:
+		return "ZLIB"
+	default:
+		return "Compression(?)"
+	}
+}
+
+// DetectPrefixLength is the number of leading bytes of a file that
+// DetectCompression needs to be sure of its answer: the length of a record
+// header.
+const DetectPrefixLength = headerLength
+
+// DetectCompression guesses the compression format of a TFRecord file from its
+// name and its first bytes, which should be DetectPrefixLength bytes or as
+// many as the file has, if fewer. A ".gz" or ".zz" suffix means gzip or zlib,
+// respectively. Otherwise, a file is taken to be compressed if it starts with
+// a gzip or zlib header and not with a valid record header. If the prefix is
+// too short to tell and could still be either, ok is false, and the caller
+// should try again once the file has grown.
+func DetectCompression(name string, prefix []byte) (c Compression, ok bool) {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return GzipCompression, true
+	case strings.HasSuffix(name, ".zz"):
+		return ZlibCompression, true
+	}
+	if len(prefix) >= headerLength {
+		length := prefix[lengthOffset:lengthCRCOffset]
+		if binary.LittleEndian.Uint32(prefix[lengthCRCOffset:dataOffset]) == computeMaskedCRC(length) {
+			return NoCompression, true
+		}
+	}
+	c = NoCompression
+	if isGzipHeader(prefix) {
+		c = GzipCompression
+	} else if isZlibHeader(prefix) {
+		c = ZlibCompression
+	}
+	// A short prefix that might be a compressed header could also be
+	// the start of a record header, and vice versa.
+	if len(prefix) < headerLength && (c != NoCompression || len(prefix) < 2) {
+		return c, false
+	}
+	return c, true
+}
+
+// isGzipHeader tests whether a nonempty prefix starts with the gzip magic
+// number, or as much of it as the prefix has.
+func isGzipHeader(prefix []byte) bool {
+	magic := []byte{0x1f, 0x8b}
+	if len(prefix) == 0 {
+		return false
+	}
+	if len(prefix) < len(magic) {
+		return bytes.HasPrefix(magic, prefix)
+	}
+	return bytes.HasPrefix(prefix, magic)
+}
+
+// isZlibHeader tests whether a prefix starts with a zlib header for a deflate
+// stream without a preset dictionary, as Go's zlib package can read.
+func isZlibHeader(prefix []byte) bool {
+	if len(prefix) < 2 {
+		return false
+	}
+	cmf, flg := prefix[0], prefix[1]
+	const deflate, maxWindow, fdict = 8, 7, 0x20
+	return cmf&0x0f == deflate && cmf>>4 <= maxWindow && flg&fdict == 0 && (uint16(cmf)<<8|uint16(flg))%31 == 0
+}
+
+// ErrInflaterClosed is returned by reads from an Inflater after it has been
+// closed.
+var ErrInflaterClosed = errors.New("read from closed Inflater")
+
+// An Inflater decompresses a gzip or zlib stream from a file that may still be
+// being written. When the compressed input runs out, even partway through a
+// compressed block, Read returns io.EOF, but the Inflater keeps its
+// decompression state: after the file grows, Read resumes where it left off.
+// The Inflater only returns io.EOF for good at the end of a zlib stream; for
+// gzip, more members may follow.
+//
+// An Inflater decompresses in a goroutine, which blocks while waiting for
+// input and exits when the Inflater is closed. Read and Close may be called
+// concurrently, but not Read and Read.
+type Inflater struct {
+	// out carries each chunk of decompressed data from the goroutine,
+	// and the final error.
+	out chan inflated
+	// starved is sent on by the goroutine when it has run out of input,
+	// after which it waits for a send on more before trying again.
+	starved chan struct{}
+	more    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	// bytesIn counts compressed bytes read by the goroutine; use atomic
+	// operations.
+	bytesIn int64
+
+	// The rest of the fields are owned by Read.
+
+	// buf holds decompressed data received but not yet read.
+	buf []byte
+	// err is the terminal error, if any has been received.
+	err error
+	// waiting is true if the goroutine is waiting for a send on more.
+	waiting bool
+}
+
+type inflated struct {
+	data []byte
+	err  error
+}
+
+// inflateChunkSize is the size of the buffer into which the goroutine
+// decompresses data.
+const inflateChunkSize = 32 << 10
+
+// NewInflater starts decompressing r, which must not be NoCompression. Reads
+// from r that return io.EOF are retried as needed after the Inflater returns
+// io.EOF from its own Read.
+func NewInflater(c Compression, r io.Reader) *Inflater {
+	z := &Inflater{
+		out:     make(chan inflated),
+		starved: make(chan struct{}),
+		more:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go z.run(c, &inflaterInput{z: z, r: r})
+	return z
+}
+
+func (z *Inflater) run(c Compression, in io.Reader) {
+	// Share one buffered reader across gzip members, so that none of
+	// the input is lost when starting the next member.
+	br := bufio.NewReader(in)
+	var zr io.Reader
+	var nextMember func() error
+	var err error
+	switch c {
+	case GzipCompression:
+		var gr *gzip.Reader
+		gr, err = gzip.NewReader(br)
+		if err == nil {
+			// In multistream mode, a gzip.Reader holds back the
+			// end of each member until it has read the header of
+			// the next, which may not have been written yet.
+			gr.Multistream(false)
+			zr = gr
+			nextMember = func() error {
+				if err := gr.Reset(br); err != nil {
+					return err
+				}
+				gr.Multistream(false)
+				return nil
+			}
+		}
+	case ZlibCompression:
+		zr, err = zlib.NewReader(br)
+	default:
+		err = errors.New("Inflater: unsupported compression " + c.String())
+	}
+	for err == nil {
+		buf := make([]byte, inflateChunkSize)
+		var n int
+		n, err = zr.Read(buf)
+		if n > 0 {
+			select {
+			case z.out <- inflated{data: buf[:n]}:
+			case <-z.done:
+				return
+			}
+		}
+		if err == io.EOF && nextMember != nil {
+			err = nextMember()
+		}
+	}
+	if err == ErrInflaterClosed {
+		return
+	}
+	select {
+	case z.out <- inflated{err: err}:
+	case <-z.done:
+	}
+}
+
+// inflaterInput feeds the compressed input to an Inflater's decompressor,
+// waiting for more input on io.EOF rather than passing it along, since the
+// decompressors can't recover from an unexpected EOF. A read of no bytes with
+// no error is treated the same way, rather than retried right away.
+type inflaterInput struct {
+	z *Inflater
+	r io.Reader
+}
+
+func (in *inflaterInput) Read(p []byte) (int, error) {
+	z := in.z
+	for {
+		n, err := in.r.Read(p)
+		atomic.AddInt64(&z.bytesIn, int64(n))
+		if err == io.EOF {
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+		select {
+		case z.starved <- struct{}{}:
+		case <-z.done:
+			return 0, ErrInflaterClosed
+		}
+		select {
+		case <-z.more:
+		case <-z.done:
+			return 0, ErrInflaterClosed
+		}
+	}
+}
+
+// Read implements io.Reader. It returns io.EOF when all the compressed input
+// read so far has been decompressed and returned.
+func (z *Inflater) Read(p []byte) (int, error) {
+	if len(z.buf) > 0 {
+		n := copy(p, z.buf)
+		z.buf = z.buf[n:]
+		return n, nil
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.waiting {
+		select {
+		case z.more <- struct{}{}:
+			z.waiting = false
+		case <-z.done:
+			return 0, ErrInflaterClosed
+		}
+	}
+	select {
+	case res := <-z.out:
+		if res.err != nil {
+			z.err = res.err
+			return 0, res.err
+		}
+		n := copy(p, res.data)
+		z.buf = res.data[n:]
+		return n, nil
+	case <-z.starved:
+		z.waiting = true
+		return 0, io.EOF
+	case <-z.done:
+		return 0, ErrInflaterClosed
+	}
+}
+
+// BytesIn returns the number of compressed bytes read so far. This includes
+// input that the decompressor has buffered but not yet decompressed. It may
+// be called concurrently with anything.
+func (z *Inflater) BytesIn() int64 {
+	return atomic.LoadInt64(&z.bytesIn)
+}
+
+// Close stops the decompressing goroutine. It doesn't close the underlying
+// reader. It always returns nil.
+func (z *Inflater) Close() error {
+	z.once.Do(func() { close(z.done) })
+	return nil
+}
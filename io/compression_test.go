@@ -0,0 +1,186 @@
+package io
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestDetectCompression(t *testing.T) {
+	var record bytes.Buffer
+	rec := NewTFRecord([]byte("\x1a\x0dbrain.Event:2"))
+	rec.Write(&record)
+	compressed := func(c Compression) []byte {
+		var buf bytes.Buffer
+		w := newTestCompressor(t, c, &buf)
+		w.Write(record.Bytes())
+		w.Close()
+		return buf.Bytes()
+	}
+	// A record whose length starts with a valid zlib header.
+	zlibLike := NewTFRecord(make([]byte, 0x178))
+	var zlibLikeRecord bytes.Buffer
+	zlibLike.Write(&zlibLikeRecord)
+
+	cases := []struct {
+		desc   string
+		name   string
+		prefix []byte
+		want   Compression
+		wantOK bool
+	}{
+		{"record", "tfevents", record.Bytes(), NoCompression, true},
+		{"record header", "tfevents", record.Bytes()[:DetectPrefixLength], NoCompression, true},
+		{"record header with zlib-like length", "tfevents", zlibLikeRecord.Bytes()[:DetectPrefixLength], NoCompression, true},
+		{"gzip", "tfevents", compressed(GzipCompression)[:DetectPrefixLength], GzipCompression, true},
+		{"zlib", "tfevents", compressed(ZlibCompression)[:DetectPrefixLength], ZlibCompression, true},
+		{"gzip suffix", "tfevents.gz", nil, GzipCompression, true},
+		{"zlib suffix", "tfevents.zz", record.Bytes(), ZlibCompression, true},
+		{"garbage", "tfevents", bytes.Repeat([]byte{0xff}, DetectPrefixLength), NoCompression, true},
+		{"empty", "tfevents", nil, NoCompression, false},
+		{"short gzip", "tfevents", compressed(GzipCompression)[:1], GzipCompression, false},
+		{"short zlib", "tfevents", compressed(ZlibCompression)[:4], ZlibCompression, false},
+		{"short record", "tfevents", record.Bytes()[:4], NoCompression, true},
+	}
+	for _, c := range cases {
+		got, ok := DetectCompression(c.name, c.prefix)
+		if got != c.want || ok != c.wantOK {
+			t.Errorf("%s: DetectCompression(%q, %x): got %v, %v; want %v, %v", c.desc, c.name, c.prefix, got, ok, c.want, c.wantOK)
+		}
+	}
+}
+
+type testCompressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func newTestCompressor(t *testing.T, c Compression, w io.Writer) testCompressor {
+	switch c {
+	case GzipCompression:
+		return gzip.NewWriter(w)
+	case ZlibCompression:
+		return zlib.NewWriter(w)
+	default:
+		t.Fatalf("unsupported compression %v", c)
+		return nil
+	}
+}
+
+// readToEOF reads from r until io.EOF, failing the test on other errors.
+func readToEOF(t *testing.T, r io.Reader) []byte {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	return data
+}
+
+func TestInflaterGrowing(t *testing.T) {
+	for _, c := range []Compression{GzipCompression, ZlibCompression} {
+		t.Run(c.String(), func(t *testing.T) {
+			first := bytes.Repeat([]byte("first part; "), 1000)
+			second := bytes.Repeat([]byte("second part; "), 1000)
+			var buf bytes.Buffer
+			w := newTestCompressor(t, c, &buf)
+			w.Write(first)
+			w.Flush()
+			flushed := buf.Len()
+			w.Write(second)
+			w.Close()
+			stream := buf.Bytes()
+
+			// Cut the stream partway through the second block, and
+			// then cut it again a byte at a time.
+			cut := flushed + (len(stream)-flushed)/2
+			sr := scriptedReader{bytes.NewBuffer(stream[:cut])}
+			for _, b := range stream[cut:] {
+				sr = append(sr, bytes.NewBuffer([]byte{b}))
+			}
+			z := NewInflater(c, &sr)
+			defer z.Close()
+
+			got := readToEOF(t, z)
+			if !bytes.HasPrefix(got, first) || !bytes.HasPrefix(append(first, second...), got) {
+				t.Fatalf("first read: got %v bytes, want at least first part and a prefix of the rest", len(got))
+			}
+			for i := cut; i < len(stream); i++ {
+				got = append(got, readToEOF(t, z)...)
+			}
+			if want := append(first, second...); !bytes.Equal(got, want) {
+				t.Errorf("after growth: got %v bytes, want %v", len(got), len(want))
+			}
+			if n := z.BytesIn(); n != int64(len(stream)) {
+				t.Errorf("BytesIn(): got %v, want %v", n, len(stream))
+			}
+		})
+	}
+}
+
+func TestInflaterGzipMultistream(t *testing.T) {
+	var buf bytes.Buffer
+	for _, s := range []string{"hello, ", "world"} {
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+	}
+	stream := buf.Bytes()
+	sr := scriptedReader{bytes.NewBuffer(stream[:len(stream)/2]), bytes.NewBuffer(stream[len(stream)/2:])}
+	z := NewInflater(GzipCompression, &sr)
+	defer z.Close()
+	got := readToEOF(t, z)
+	got = append(got, readToEOF(t, z)...)
+	if string(got) != "hello, world" {
+		t.Errorf("got %q, want %q", got, "hello, world")
+	}
+}
+
+// emptyReader returns no bytes and no error from every read.
+type emptyReader struct{}
+
+func (emptyReader) Read(p []byte) (int, error) {
+	return 0, nil
+}
+
+func TestInflaterEmptyReads(t *testing.T) {
+	z := NewInflater(GzipCompression, emptyReader{})
+	defer z.Close()
+	done := make(chan error)
+	go func() {
+		_, err := z.Read(make([]byte, 10))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("Read: got %v, want EOF", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Read: still running after 5s")
+	}
+}
+
+func TestInflaterCorrupt(t *testing.T) {
+	z := NewInflater(ZlibCompression, bytes.NewReader([]byte{0x78, 0x9c, 0xff, 0xff, 0xff}))
+	defer z.Close()
+	if n, err := z.Read(make([]byte, 10)); n != 0 || err == nil || err == io.EOF {
+		t.Errorf("Read: got %v, %v; want 0, corruption error", n, err)
+	}
+}
+
+func TestInflaterClose(t *testing.T) {
+	z := NewInflater(GzipCompression, bytes.NewReader(nil))
+	if n, err := z.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Errorf("Read before any input: got %v, %v; want 0, EOF", n, err)
+	}
+	if err := z.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if n, err := z.Read(make([]byte, 10)); n != 0 || err != ErrInflaterClosed {
+		t.Errorf("Read after Close: got %v, %v; want 0, %v", n, err, ErrInflaterClosed)
+	}
+}
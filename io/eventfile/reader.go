@@ -4,6 +4,8 @@ import (
 	"io"
 
 	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/tensorflow/tensorflow/tensorflow/go/core/util/event_go_proto"
 	tbio "github.com/wchargin/tensorboard-data-server/io"
@@ -16,6 +18,13 @@ type EventResult struct {
 	Event *event_go_proto.Event
 	Err   error
 	Fatal bool
+	// Offset is the byte offset within the file of the start of the
+	// record that produced this result.
+	Offset int64
+	// NextOffset is the byte offset within the file just past the end of
+	// the record that produced this result, where the next record starts.
+	// If Fatal is true, it equals Offset.
+	NextOffset int64
 }
 
 // A WakeAction tells a Reader what to do after waking up.
@@ -33,8 +42,23 @@ const (
 type ReaderBuilder struct {
 	// File is the input stream for the event file.
 	File io.Reader
+	// Offset is the byte offset within the event file at which File
+	// starts, which must be at a record boundary. It's optional, and only
+	// affects the offsets reported in results.
+	Offset int64
+	// Recover says to skip past corrupt record headers rather than giving
+	// up on the rest of the file. On a header whose length fails its
+	// checksum, the reader scans forward for the next plausible header and
+	// reports the bytes skipped as a non-fatal error. Scanning reads a byte
+	// at a time, so File should be buffered.
+	Recover bool
 }
 
+// MaxRecoveredRecordLength is the largest record length that a Reader in
+// recovery mode will accept when scanning for the next record header. Longer
+// lengths are taken to be garbage that happens to pass its checksum.
+const MaxRecoveredRecordLength = 256 << 20
+
 type readerState struct {
 	// Results is the input end of Reader.Results.
 	Results chan<- EventResult
@@ -42,6 +66,8 @@ type readerState struct {
 	Asleep chan<- struct{}
 	// Wake is the output end of Reader.Wake.
 	Wake <-chan WakeAction
+	// recover is ReaderBuilder.Recover.
+	recover bool
 }
 
 // Reader reads TFRecords from an event file and parses them as Event protos.
@@ -67,21 +93,47 @@ func (b ReaderBuilder) Start() *Reader {
 	results := make(chan EventResult)
 	asleep := make(chan struct{})
 	wake := make(chan WakeAction)
-	rs := &readerState{Results: results, Asleep: asleep, Wake: wake}
-	go rs.start(b.File)
+	rs := &readerState{Results: results, Asleep: asleep, Wake: wake, recover: b.Recover}
+	go rs.start(b.File, b.Offset)
 	return &Reader{Results: results, Asleep: asleep, Wake: wake}
 }
 
-func (efr *readerState) start(file io.Reader) {
+func (efr *readerState) start(file io.Reader, offset int64) {
 	var recordState *tbio.TFRecordState
+	// offset is the byte offset of the start of the next record, or of
+	// the next byte not yet skipped while scanning for a header.
 	switch <-efr.Wake {
 	case Resume:
 		// let's go
 	case Abort:
 		return
 	}
+	// scanning is true while recovering from a corrupt header, and skipped
+	// counts the bytes skipped past offset but not yet reported.
+	scanning := false
+	var skipped int64
 	for {
-		record, err := tbio.ReadRecord(&recordState, file)
+		var record *tbio.TFRecord
+		var err error
+		if scanning {
+			var n int64
+			n, err = tbio.ScanRecordHeader(&recordState, file, MaxRecoveredRecordLength)
+			skipped += n
+			if (err == nil || err == io.EOF) && skipped > 0 {
+				// Report what's been skipped so far, even before
+				// going to sleep, so that reported offsets are
+				// always valid places to resume.
+				efr.Results <- skippedResult(offset, skipped)
+				offset += skipped
+				skipped = 0
+			}
+			if err == nil {
+				scanning = false
+				continue
+			}
+		} else {
+			record, err = tbio.ReadRecord(&recordState, file)
+		}
 		if err == io.EOF {
 			efr.Asleep <- struct{}{}
 			switch <-efr.Wake {
@@ -92,19 +144,43 @@ func (efr *readerState) start(file io.Reader) {
 			}
 		}
 		if err != nil {
-			efr.Results <- EventResult{Err: err, Fatal: true}
+			if efr.recover && !scanning && corrupt(err) {
+				scanning = true
+				continue
+			}
+			efr.Results <- EventResult{Err: err, Fatal: true, Offset: offset, NextOffset: offset}
 			return
 		}
 		recordState = nil
+		recordOffset := offset
+		offset += int64(record.ByteSize())
 		event, err := efr.readEvent(record)
 		if err != nil {
-			efr.Results <- EventResult{Err: err, Fatal: false}
+			efr.Results <- EventResult{Err: err, Fatal: false, Offset: recordOffset, NextOffset: offset}
 			continue
 		}
-		efr.Results <- EventResult{Event: event}
+		efr.Results <- EventResult{Event: event, Offset: recordOffset, NextOffset: offset}
+	}
+}
+
+// corrupt tests whether an error from tbio.ReadRecord indicates a corrupt
+// record header, from which recovery may be possible.
+func corrupt(err error) bool {
+	switch status.Code(err) {
+	case codes.DataLoss, codes.OutOfRange:
+		return true
+	default:
+		return false
 	}
 }
 
+// skippedResult reports a range of corrupt bytes skipped while recovering.
+func skippedResult(offset int64, skipped int64) EventResult {
+	end := offset + skipped
+	err := status.Errorf(codes.DataLoss, "skipped %v corrupt bytes at offsets [%v, %v)", skipped, offset, end)
+	return EventResult{Err: err, Offset: offset, NextOffset: end}
+}
+
 func (efr *readerState) readEvent(record *tbio.TFRecord) (*event_go_proto.Event, error) {
 	if err := record.Checksum(); err != nil {
 		return nil, err
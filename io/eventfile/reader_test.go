@@ -2,6 +2,7 @@ package eventfile
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -158,6 +159,12 @@ func TestEventFileWithBadRecordLength(t *testing.T) {
 		if got.Event != nil || got.Err == nil || !strings.Contains(got.Err.Error(), wantMsgSubstr) || !got.Fatal {
 			t.Errorf("first read: got %+v, want fatal failure with %q", got, wantMsgSubstr)
 		}
+		if got, want := got.Offset, int64(okRecord.ByteSize()); got != want {
+			t.Errorf("first read: Offset: got %v, want %v", got, want)
+		}
+		if got, want := got.NextOffset, got.Offset; got != want {
+			t.Errorf("first read: NextOffset: got %v, want %v", got, want)
+		}
 	case <-efr.Asleep:
 		t.Fatalf("got Asleep, want second result")
 	case <-time.After(time.Second):
@@ -176,6 +183,80 @@ func TestEventFileWithBadRecordLength(t *testing.T) {
 	}
 }
 
+func TestEventFileRecover(t *testing.T) {
+	var buf bytes.Buffer
+	inputEvent := &epb.Event{What: &epb.Event_FileVersion{FileVersion: "brain.Event:2"}}
+	okRecord := tbio.NewTFRecord(marshalHard(t, inputEvent))
+	okSize := int64(okRecord.ByteSize())
+	garbage := func(n int) []byte { return bytes.Repeat([]byte{0xff}, n) }
+
+	okRecord.Write(&buf)
+	buf.Write(garbage(16))
+	okRecord.Write(&buf)
+	buf.Write(garbage(20))
+
+	efr := ReaderBuilder{File: &buf, Offset: 100, Recover: true}.Start()
+	efr.Wake <- Resume
+
+	next := func(desc string) EventResult {
+		select {
+		case got := <-efr.Results:
+			return got
+		case <-efr.Asleep:
+			t.Fatalf("%s: got Asleep, want result", desc)
+		case <-time.After(time.Second):
+			t.Fatalf("%s: no interaction after 1s; want result", desc)
+		}
+		panic("unreachable")
+	}
+	wantEvent := func(desc string, offset int64) {
+		got := next(desc)
+		if !proto.Equal(got.Event, inputEvent) || got.Err != nil || got.Offset != offset || got.NextOffset != offset+okSize {
+			t.Errorf("%s: got %+v, want event at offset %v", desc, got, offset)
+		}
+	}
+	wantSkipped := func(desc string, offset int64, n int64) {
+		got := next(desc)
+		wantMsg := fmt.Sprintf("skipped %v corrupt bytes", n)
+		if got.Err == nil || got.Fatal || !strings.Contains(got.Err.Error(), wantMsg) || got.Offset != offset || got.NextOffset != offset+n {
+			t.Errorf("%s: got %+v, want non-fatal error %q at offsets [%v, %v)", desc, got, wantMsg, offset, offset+n)
+		}
+	}
+
+	offset := int64(100)
+	wantEvent("first record", offset)
+	offset += okSize
+	wantSkipped("first garbage", offset, 16)
+	offset += 16
+	wantEvent("second record", offset)
+	offset += okSize
+	// Trailing garbage is reported up to the last 11 bytes, which might
+	// yet start a valid header.
+	wantSkipped("trailing garbage", offset, 9)
+	offset += 9
+	select {
+	case <-efr.Asleep:
+	case got := <-efr.Results:
+		t.Fatalf("got %+v, want Asleep", got)
+	case <-time.After(time.Second):
+		t.Fatalf("no interaction after 1s; want Asleep")
+	}
+
+	okRecord.Write(&buf)
+	efr.Wake <- Resume
+	wantSkipped("rest of trailing garbage", offset, 11)
+	offset += 11
+	wantEvent("third record", offset)
+	select {
+	case <-efr.Asleep:
+	case got := <-efr.Results:
+		t.Fatalf("got %+v, want Asleep", got)
+	case <-time.After(time.Second):
+		t.Fatalf("no interaction after 1s; want Asleep")
+	}
+	efr.Wake <- Abort
+}
+
 func TestEventFileWithBadRecordData(t *testing.T) {
 	var buf bytes.Buffer
 
@@ -204,8 +285,8 @@ func TestEventFileWithBadRecordData(t *testing.T) {
 	// Second read should succeed.
 	select {
 	case got := <-efr.Results:
-		want := EventResult{Event: inputEvent}
-		if !proto.Equal(got.Event, want.Event) || got.Err != nil || got.Fatal {
+		want := EventResult{Event: inputEvent, Offset: int64(okRecord.ByteSize()), NextOffset: 2 * int64(okRecord.ByteSize())}
+		if !proto.Equal(got.Event, want.Event) || got.Err != nil || got.Fatal || got.Offset != want.Offset || got.NextOffset != want.NextOffset {
 			t.Errorf("second read: got %+v, want %+v", got, want)
 		}
 	case <-efr.Asleep:
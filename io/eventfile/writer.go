@@ -0,0 +1,273 @@
+package eventfile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	epb "github.com/tensorflow/tensorflow/tensorflow/go/core/util/event_go_proto"
+	tbio "github.com/wchargin/tensorboard-data-server/io"
+)
+
+// FileVersion is the value of the file_version field of the first event in
+// each event file written by a Writer.
+const FileVersion = "brain.Event:2"
+
+// defaultFlushInterval matches the default of TensorFlow's summary writers.
+const defaultFlushInterval = 2 * time.Minute
+
+// WriterBuilder specifies options for a Writer.
+type WriterBuilder struct {
+	// Dir is the local directory in which to create event files. It must
+	// already exist.
+	Dir string
+	// Suffix is appended to the name of each event file. It's optional.
+	Suffix string
+	// Hostname is included in the name of each event file. It's optional;
+	// empty means to use os.Hostname.
+	Hostname string
+
+	// FlushInterval controls how often buffered events are written to
+	// disk. It's optional; zero means to use a default of two minutes, and
+	// a negative value means to flush only on calls to Flush and Close.
+	FlushInterval time.Duration
+	// MaxFileSize is the size in bytes after which to start a new event
+	// file. It's optional; zero means to write a single file.
+	MaxFileSize int64
+}
+
+// Writer writes events to event files that TensorBoard can read, named like
+// "events.out.tfevents.<timestamp>.<hostname>". Each file starts with an
+// event whose file_version is FileVersion. A Writer is safe for concurrent
+// use.
+type Writer struct {
+	dir         string
+	suffix      string
+	hostname    string
+	maxFileSize int64
+
+	// done is closed by Close to stop the flushing goroutine, if any.
+	done chan struct{}
+
+	// mu locks all fields below.
+	mu sync.Mutex
+	// closed is set by Close.
+	closed bool
+	// file is the current event file, or nil if the writer is closed or
+	// failed to open a new file after rotating.
+	file *os.File
+	// buf buffers writes to file.
+	buf *bufio.Writer
+	// size is the number of bytes written to file so far, including
+	// buffered bytes.
+	size int64
+	// lastTimestamp is the timestamp in the name of the most recently
+	// created file. Each file's timestamp is strictly greater than the
+	// last so that files sort in the order that they were written.
+	lastTimestamp int64
+	// pendingErr is the error from the last failed rotation or periodic
+	// flush, if it hasn't yet been returned by Write or Close.
+	pendingErr error
+}
+
+// Start creates the first event file and returns a writer for it. If
+// FlushInterval is positive, it starts a goroutine to flush periodically; call
+// Close to stop it.
+func (b WriterBuilder) Start() (*Writer, error) {
+	hostname := b.Hostname
+	if hostname == "" {
+		var err error
+		if hostname, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+	w := &Writer{
+		dir:         b.Dir,
+		suffix:      b.Suffix,
+		hostname:    hostname,
+		maxFileSize: b.MaxFileSize,
+		done:        make(chan struct{}),
+	}
+	if err := w.openFile(); err != nil {
+		return nil, err
+	}
+	interval := b.FlushInterval
+	if interval == 0 {
+		interval = defaultFlushInterval
+	}
+	if interval > 0 {
+		go w.flushEvery(interval)
+	}
+	return w, nil
+}
+
+func (w *Writer) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !w.periodicFlush() {
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// periodicFlush flushes buffered events for flushEvery. A failure is saved for
+// the next call to Write or Close to return, since no caller is waiting on
+// this one. It returns false if the writer is closed.
+func (w *Writer) periodicFlush() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return false
+	}
+	if w.file == nil {
+		return true
+	}
+	if err := w.buf.Flush(); err != nil && w.pendingErr == nil {
+		w.pendingErr = fmt.Errorf("flushing event file: %v", err)
+	}
+	return true
+}
+
+// openFile creates a new event file and writes its file_version event. The
+// caller must hold w.mu or otherwise have exclusive access to w. On error,
+// w.file may be left nil.
+func (w *Writer) openFile() error {
+	now := time.Now()
+	ts := now.Unix()
+	if ts <= w.lastTimestamp {
+		ts = w.lastTimestamp + 1
+	}
+	for {
+		name := fmt.Sprintf("events.out.tfevents.%010d.%s%s", ts, w.hostname, w.suffix)
+		f, err := os.OpenFile(filepath.Join(w.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			ts++ // e.g., another writer in the same second
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		w.file = f
+		break
+	}
+	w.lastTimestamp = ts
+	w.buf = bufio.NewWriter(w.file)
+	w.size = 0
+	header := &epb.Event{
+		WallTime: float64(now.UnixNano()) / 1e9,
+		What:     &epb.Event_FileVersion{FileVersion: FileVersion},
+	}
+	return w.writeEvent(header)
+}
+
+// writeEvent serializes an event to the current file. The caller must hold
+// w.mu.
+func (w *Writer) writeEvent(ev *epb.Event) error {
+	data, err := proto.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	record := tbio.NewTFRecord(data)
+	if err := record.Write(w.buf); err != nil {
+		return err
+	}
+	w.size += int64(record.ByteSize())
+	return nil
+}
+
+// errWriterClosed is returned by operations on a closed Writer.
+var errWriterClosed = errors.New("event file writer is closed")
+
+// Write appends an event to the current event file. The event may be buffered
+// until the next flush. If the file has reached the maximum size, Write then
+// closes it and starts a new one. A failure to do so doesn't affect the event
+// just written; instead, the next call to Write or Close returns the error
+// without doing anything else, and the call to Write after that retries
+// starting a new file. Failures of periodic flushes are returned the same way.
+func (w *Writer) Write(ev *epb.Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errWriterClosed
+	}
+	if err := w.pendingErr; err != nil {
+		w.pendingErr = nil
+		return err
+	}
+	if w.file == nil {
+		// Retry after a failed rotation.
+		if err := w.openFile(); err != nil {
+			return err
+		}
+	}
+	if err := w.writeEvent(ev); err != nil {
+		return err
+	}
+	if w.maxFileSize > 0 && w.size >= w.maxFileSize {
+		if err := w.closeFile(); err != nil {
+			w.pendingErr = fmt.Errorf("closing event file: %v", err)
+		} else if err := w.openFile(); err != nil {
+			w.pendingErr = fmt.Errorf("starting new event file: %v", err)
+		}
+	}
+	return nil
+}
+
+// Flush writes any buffered events to disk.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errWriterClosed
+	}
+	if w.file == nil {
+		return nil
+	}
+	return w.buf.Flush()
+}
+
+// closeFile flushes and closes the current file, leaving w.file nil. The
+// caller must hold w.mu.
+func (w *Writer) closeFile() error {
+	err := w.buf.Flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	w.buf = nil
+	return err
+}
+
+// Close implements io.Closer. It flushes and closes the current event file and
+// stops the flushing goroutine. It returns any error from a failed rotation or
+// periodic flush not yet returned by Write. Later calls to any method return an
+// error.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errWriterClosed
+	}
+	w.closed = true
+	close(w.done)
+	err := w.pendingErr
+	w.pendingErr = nil
+	if w.file != nil {
+		if closeErr := w.closeFile(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,305 @@
+package eventfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	spb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/summary_go_proto"
+	epb "github.com/tensorflow/tensorflow/tensorflow/go/core/util/event_go_proto"
+)
+
+func scalarEvent(step int64) *epb.Event {
+	return &epb.Event{
+		Step:     step,
+		WallTime: float64(1000 + step),
+		What: &epb.Event_Summary{Summary: &spb.Summary{
+			Value: []*spb.Summary_Value{
+				{Tag: "loss", Value: &spb.Summary_Value_SimpleValue{SimpleValue: float32(step)}},
+			},
+		}},
+	}
+}
+
+// readAllEvents reads all events from a complete event file, failing the test
+// on any error.
+func readAllEvents(t *testing.T, path string) []*epb.Event {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	efr := ReaderBuilder{File: f}.Start()
+	efr.Wake <- Resume
+	var events []*epb.Event
+	for {
+		select {
+		case res := <-efr.Results:
+			if res.Err != nil {
+				t.Fatalf("%s: reading event %v: %v", path, len(events), res.Err)
+			}
+			events = append(events, res.Event)
+		case <-efr.Asleep:
+			efr.Wake <- Abort
+			return events
+		case <-time.After(time.Second):
+			t.Fatalf("%s: no interaction after 1s", path)
+		}
+	}
+}
+
+// eventFiles lists the names of the files in dir, in sorted order.
+func eventFiles(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func checkFileVersion(t *testing.T, name string, ev *epb.Event) {
+	if got := ev.GetFileVersion(); got != FileVersion {
+		t.Errorf("%s: first event: got %v, want file_version %q", name, ev, FileVersion)
+	}
+	if ev.WallTime == 0 {
+		t.Errorf("%s: first event: got %v, want wall time", name, ev)
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := WriterBuilder{Dir: dir, Hostname: "myhost", Suffix: ".v2"}.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []*epb.Event
+	for step := int64(0); step < 3; step++ {
+		ev := scalarEvent(step)
+		if err := w.Write(ev); err != nil {
+			t.Fatalf("Write(%v): %v", ev, err)
+		}
+		want = append(want, ev)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := w.Write(scalarEvent(3)); err == nil {
+		t.Errorf("Write after Close: got nil, want error")
+	}
+
+	names := eventFiles(t, dir)
+	if len(names) != 1 {
+		t.Fatalf("files: got %v, want one file", names)
+	}
+	if ok, _ := regexp.MatchString(`^events\.out\.tfevents\.\d{10}\.myhost\.v2$`, names[0]); !ok {
+		t.Errorf("file name: got %q, want events.out.tfevents.<ts>.myhost.v2", names[0])
+	}
+	got := readAllEvents(t, filepath.Join(dir, names[0]))
+	if len(got) != len(want)+1 {
+		t.Fatalf("events: got %v, want file_version plus %v", got, want)
+	}
+	checkFileVersion(t, names[0], got[0])
+	for i, ev := range want {
+		if !proto.Equal(got[i+1], ev) {
+			t.Errorf("event %v: got %v, want %v", i+1, got[i+1], ev)
+		}
+	}
+}
+
+func TestWriterRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := WriterBuilder{Dir: dir, Hostname: "myhost", MaxFileSize: 100}.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const numEvents = 10
+	for step := int64(0); step < numEvents; step++ {
+		if err := w.Write(scalarEvent(step)); err != nil {
+			t.Fatalf("Write(step=%v): %v", step, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	names := eventFiles(t, dir)
+	if len(names) < 2 {
+		t.Fatalf("files: got %v, want several", names)
+	}
+	// Files should sort in the order written, so reading them in order
+	// should yield all events in order.
+	var steps []int64
+	for _, name := range names {
+		events := readAllEvents(t, filepath.Join(dir, name))
+		if len(events) == 0 {
+			t.Errorf("%s: got no events, want file_version", name)
+			continue
+		}
+		checkFileVersion(t, name, events[0])
+		for _, ev := range events[1:] {
+			steps = append(steps, ev.Step)
+		}
+	}
+	if len(steps) != numEvents {
+		t.Fatalf("steps: got %v, want 0 through %v", steps, numEvents-1)
+	}
+	for i, step := range steps {
+		if step != int64(i) {
+			t.Errorf("steps: got %v, want 0 through %v", steps, numEvents-1)
+			break
+		}
+	}
+}
+
+func TestWriterFlushInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := WriterBuilder{Dir: dir, Hostname: "myhost", FlushInterval: 10 * time.Millisecond}.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Write(scalarEvent(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, eventFiles(t, dir)[0])
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if events := readAllEvents(t, path); len(events) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("event not flushed after 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWriterFlushIntervalFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := WriterBuilder{Dir: dir, Hostname: "myhost", FlushInterval: 10 * time.Millisecond}.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Write(scalarEvent(0)); err != nil {
+		t.Fatal(err)
+	}
+	// Close the file out from under the writer so that flushes fail.
+	w.mu.Lock()
+	w.file.Close()
+	w.mu.Unlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.mu.Lock()
+		failed := w.pendingErr != nil
+		w.mu.Unlock()
+		if failed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no flush failure after 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = w.Write(scalarEvent(1))
+	if err == nil || !strings.Contains(err.Error(), "flushing event file") {
+		t.Errorf("Write after failed flush: got %v, want flush error", err)
+	}
+}
+
+func TestWriterRotationFailure(t *testing.T) {
+	parent, err := ioutil.TempDir("", "eventfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "logs")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := WriterBuilder{Dir: dir, Hostname: "myhost", MaxFileSize: 100}.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Move the directory so that the current file stays writable but a
+	// new file can't be created.
+	moved := filepath.Join(parent, "moved")
+	if err := os.Rename(dir, moved); err != nil {
+		t.Fatal(err)
+	}
+	// Writes succeed until the one after the failed rotation.
+	var step int64
+	for ; ; step++ {
+		if step == 10 {
+			t.Fatalf("Write: no error after %v writes", step)
+		}
+		if err := w.Write(scalarEvent(step)); err != nil {
+			break
+		}
+	}
+	if step == 0 {
+		t.Fatalf("Write(step=0): got error, want nil before rotating")
+	}
+	// Now the rotation can be retried.
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(scalarEvent(step)); err != nil {
+		t.Fatalf("Write(step=%v) after failed rotation: %v", step, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Each step was written exactly once.
+	var steps []int64
+	for _, d := range []string{moved, dir} {
+		for _, name := range eventFiles(t, d) {
+			for _, ev := range readAllEvents(t, filepath.Join(d, name))[1:] {
+				steps = append(steps, ev.Step)
+			}
+		}
+	}
+	if int64(len(steps)) != step+1 {
+		t.Fatalf("steps: got %v, want 0 through %v", steps, step)
+	}
+	for i, got := range steps {
+		if got != int64(i) {
+			t.Errorf("steps: got %v, want 0 through %v", steps, step)
+			break
+		}
+	}
+}
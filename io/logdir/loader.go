@@ -1,13 +1,39 @@
 package logdir
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"path/filepath"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"github.com/wchargin/tensorboard-data-server/fs"
 	"github.com/wchargin/tensorboard-data-server/io/run"
+	"github.com/wchargin/tensorboard-data-server/metrics"
+	snpb "github.com/wchargin/tensorboard-data-server/proto/snapshot_proto"
+)
+
+var (
+	runsDiscovered = promauto.With(metrics.Default).NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "runs_discovered_total",
+		Help:      "Number of runs discovered under the log directory.",
+	})
+	runsRemoved = promauto.With(metrics.Default).NewCounter(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "runs_removed_total",
+		Help:      "Number of runs removed because their event files disappeared.",
+	})
+	reloadDuration = promauto.With(metrics.Default).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "run_reload_duration_seconds",
+		Help:      "Time taken to reload a run.",
+		Buckets:   metrics.DefaultBuckets,
+	}, []string{"logdir", "run"})
 )
 
 // LoaderBuilder specifies options for a Loader.
@@ -16,6 +42,33 @@ type LoaderBuilder struct {
 	FS fs.Filesystem
 	// Logdir is the root log directory to be loaded, as a path under FS.
 	Logdir string
+	// SamplesPerPlugin configures reservoir capacities for each run. It's
+	// optional; nil means to use defaults for all plugins.
+	SamplesPerPlugin run.SamplesPerPlugin
+	// InactiveAge and CloseSuperseded configure when each run closes its
+	// event files, as on run.ReaderBuilder. They're optional; the zero
+	// values mean to keep all event files open.
+	InactiveAge     time.Duration
+	CloseSuperseded bool
+	// RecoverCorruptRecords says to skip past corrupt records in event
+	// files, as on run.ReaderBuilder.
+	RecoverCorruptRecords bool
+	// MaxConcurrentReloads limits how many runs are reloaded at once. When
+	// there are more runs than this, they take turns, each reading a
+	// bounded number of records per turn, so that a large run can't starve
+	// the others. It's optional; zero means no limit.
+	MaxConcurrentReloads int
+	// MaxConcurrentOpens limits how many event files may be in the middle
+	// of being opened at once across all runs, which bounds bursts of
+	// open calls (or requests, for remote filesystems). It doesn't bound
+	// how many files stay open afterward; see InactiveAge and
+	// CloseSuperseded for that. It's optional; zero means no limit.
+	MaxConcurrentOpens int
+	// Snapshot is a snapshot from an earlier Loader for the same logdir,
+	// as returned by Loader.Snapshot. It's optional. Runs in the snapshot
+	// resume loading where it left off; runs that can't be restored are
+	// loaded from scratch.
+	Snapshot *snpb.LogdirSnapshot
 }
 
 // Start starts a loader in a new goroutine. It starts dormant. Call Reload on
@@ -24,13 +77,33 @@ func (b LoaderBuilder) Start() *Loader {
 	ll := &Loader{
 		fs:     b.FS,
 		logdir: b.Logdir,
+		spp:    b.SamplesPerPlugin,
+
+		inactiveAge:     b.InactiveAge,
+		closeSuperseded: b.CloseSuperseded,
+		recover:         b.RecoverCorruptRecords,
+		maxReloads:      b.MaxConcurrentReloads,
+		opens:           run.NewSemaphore(b.MaxConcurrentOpens),
 
 		readers: make(map[string]*run.Reader),
 		data:    make(map[string]*run.Accumulator),
 
-		reload: make(chan struct{}),
+		reloaded: make(chan struct{}),
+		loaded:   make(chan struct{}),
+		restore:  make(map[string]*snpb.RunSnapshot),
+
+		reload: make(chan context.Context),
 		asleep: make(chan struct{}),
 	}
+	if b.Snapshot != nil {
+		if b.Snapshot.Logdir != b.Logdir {
+			fmt.Fprintf(os.Stderr, "ignoring snapshot of logdir %q for logdir %q\n", b.Snapshot.Logdir, b.Logdir)
+		} else {
+			for _, rs := range b.Snapshot.Runs {
+				ll.restore[rs.RunName] = rs
+			}
+		}
+	}
 	go ll.start()
 	return ll
 }
@@ -41,21 +114,47 @@ type Loader struct {
 	fs fs.Filesystem
 	// logdir is the root log directory being loaded, as a path under fs.
 	logdir string
+	// spp configures reservoir capacities for each run.
+	spp run.SamplesPerPlugin
+	// inactiveAge and closeSuperseded are as on LoaderBuilder.
+	inactiveAge     time.Duration
+	closeSuperseded bool
+	// recover is LoaderBuilder.RecoverCorruptRecords.
+	recover bool
+	// maxReloads is LoaderBuilder.MaxConcurrentReloads.
+	maxReloads int
+	// opens limits concurrent file opens across all run readers.
+	opens run.Semaphore
 
-	// reload is an input channel that sees unit when this loader should
-	// wake up.
-	reload chan struct{}
+	// reload is an input channel that sees a context when this loader
+	// should wake up. The reload stops early if the context is canceled.
+	reload chan context.Context
 	// asleep is an output channel that sees unit when this loader has read
 	// to EOF and gone to sleep, to be awoken later via "reload".
 	asleep chan struct{}
 
-	// mu locks the readers and data maps, not any of their contents.
+	// mu locks the readers and data maps, not any of their contents, and
+	// the reloaded channel, the loaded channel, and the reload timing.
 	mu sync.RWMutex
 	// readers maps a run name to its active reader object.
 	readers map[string]*run.Reader
 	// data maps a run name to its event accumulator. Same domain as
 	// readers.
 	data map[string]*run.Accumulator
+	// reloaded is closed and replaced each time a reload finishes, to wake
+	// up callers of Reloaded.
+	reloaded chan struct{}
+	// loaded is closed when the first reload finishes.
+	loaded chan struct{}
+	// lastReload is when the most recent reload finished, and
+	// lastReloadDuration is how long it took. Both are zero before the
+	// first reload finishes.
+	lastReload         time.Time
+	lastReloadDuration time.Duration
+
+	// restore maps run names to snapshots from which to restore those runs
+	// when they're first discovered. Owned by the loading goroutine.
+	restore map[string]*snpb.RunSnapshot
 }
 
 // Runs returns a map of all runs, keyed by name. The returned map is owned by
@@ -80,14 +179,20 @@ func (ll *Loader) Run(run string) *run.Accumulator {
 
 // start runs in its own goroutine, created by LoaderBuilder.Start.
 func (ll *Loader) start() {
-	for range ll.reload {
+	for ctx := range ll.reload {
+		start := time.Now()
 		rundirs, err := ll.rundirs()
 		if err != nil {
+			// Keep existing runs, but still go to sleep so that
+			// Reload returns.
 			fmt.Fprintf(os.Stderr, "discovering runs: %v\n", err)
-			continue
+		} else {
+			ll.mkloaders(rundirs)
+		}
+		ll.doreload(ctx)
+		if ctx.Err() == nil {
+			ll.notifyReloaded(start)
 		}
-		ll.mkloaders(rundirs)
-		ll.doreload()
 		ll.asleep <- struct{}{}
 	}
 }
@@ -104,11 +209,11 @@ func (ll *Loader) rundirs() (rundirs, error) {
 		return nil, err
 	}
 	for _, f := range files {
-		d := filepath.Dir(f) // TODO(@wchargin): fs integration?
+		d := ll.fs.Dir(f)
 		if _, ok := result[d]; ok {
 			continue
 		}
-		name, err := filepath.Rel(ll.logdir, d)
+		name, err := ll.fs.Rel(ll.logdir, d)
 		if err != nil {
 			return nil, err
 		}
@@ -127,6 +232,8 @@ func (ll *Loader) mkloaders(rundirs rundirs) {
 			continue // still exists
 		}
 		fmt.Fprintf(os.Stderr, "removing run %q\n", k)
+		runsRemoved.Inc()
+		reloadDuration.DeleteLabelValues(ll.logdir, k)
 		if err := rr.Close(); err != nil {
 			fmt.Fprintf(os.Stderr, "closing run %q: %v\n", k, err)
 		}
@@ -138,58 +245,220 @@ func (ll *Loader) mkloaders(rundirs rundirs) {
 			continue // already exists
 		}
 		fmt.Fprintf(os.Stderr, "discovered run %q\n", k)
-		rr := run.ReaderBuilder{FS: ll.fs, Dir: dir}.Start()
-		acc := run.NewAccumulator(rr)
+		runsDiscovered.Inc()
+		rb := run.ReaderBuilder{
+			FS:                    ll.fs,
+			Dir:                   dir,
+			Logdir:                ll.logdir,
+			InactiveAge:           ll.inactiveAge,
+			CloseSuperseded:       ll.closeSuperseded,
+			Opens:                 ll.opens,
+			RecoverCorruptRecords: ll.recover,
+		}
+		var rr *run.Reader
+		var acc *run.Accumulator
+		if rs, ok := ll.restore[k]; ok {
+			delete(ll.restore, k)
+			var err error
+			if rr, acc, err = run.RestoreSnapshot(rb, ll.spp, rs); err != nil {
+				fmt.Fprintf(os.Stderr, "restoring run %q from snapshot: %v; loading from scratch\n", k, err)
+			}
+		}
+		if rr == nil {
+			rr = rb.Start()
+			acc = run.NewAccumulator(rr, ll.spp)
+		}
 		ll.readers[k] = rr
 		ll.data[k] = acc
 	}
 }
 
-func (ll *Loader) doreload() {
-	var wg sync.WaitGroup
+// reloadTurnRecords is the number of records that a run reads per turn of a
+// reload.
+const reloadTurnRecords = 1000
+
+// A reloadJob is a run waiting for a turn to reload.
+type reloadJob struct {
+	name string
+	rr   *run.Reader
+	// elapsed is the total duration of the run's turns so far.
+	elapsed time.Duration
+}
 
+// doreload reloads all runs, using up to ll.maxReloads workers. Runs read in
+// turns, in round-robin order if there are more runs than workers. Once ctx is
+// canceled, each run stops at the end of its current turn and sends a
+// checkpoint of how far it read, so that its progress can be snapshotted.
+func (ll *Loader) doreload(ctx context.Context) {
 	ll.mu.RLock()
-	readers := make([]*run.Reader, len(ll.readers))
-	{
-		i := 0
-		for _, rr := range ll.readers {
-			readers[i] = rr
-			i++
-		}
+	names := make([]string, 0, len(ll.readers))
+	for k := range ll.readers {
+		names = append(names, k)
+	}
+	queue := make(chan *reloadJob, len(ll.readers))
+	sort.Strings(names)
+	for _, k := range names {
+		queue <- &reloadJob{name: k, rr: ll.readers[k]}
 	}
 	ll.mu.RUnlock()
 
-	wg.Add(len(readers))
-	for _, rr := range readers {
-		go func(rr *run.Reader) {
-			rr.Reload()
-			wg.Done()
-		}(rr)
+	workers := ll.maxReloads
+	if workers <= 0 || workers >= len(names) {
+		// Every run gets its own worker. Runs still read in turns, so
+		// that cancellation is noticed promptly.
+		workers = len(names)
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(names))
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range queue {
+				start := time.Now()
+				done := job.rr.ReloadSome(reloadTurnRecords)
+				job.elapsed += time.Since(start)
+				if !done && ctx.Err() != nil {
+					job.rr.Checkpoint()
+					wg.Done()
+					continue
+				}
+				if !done {
+					queue <- job // back of the line
+					continue
+				}
+				reloadDuration.WithLabelValues(ll.logdir, job.name).Observe(job.elapsed.Seconds())
+				wg.Done()
+			}
+		}()
 	}
 	wg.Wait()
+	close(queue)
+}
+
+// notifyReloaded records the timing of a reload that started at the given
+// time and just finished, and wakes up all callers waiting on Reloaded or
+// Loaded.
+func (ll *Loader) notifyReloaded(start time.Time) {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	ll.lastReload = time.Now()
+	ll.lastReloadDuration = ll.lastReload.Sub(start)
+	close(ll.reloaded)
+	ll.reloaded = make(chan struct{})
+	select {
+	case <-ll.loaded:
+	default:
+		close(ll.loaded)
+	}
+}
+
+// Loaded returns a channel that is closed once the first reload finishes.
+func (ll *Loader) Loaded() <-chan struct{} {
+	return ll.loaded
+}
+
+// A Status describes the progress of a Loader.
+type Status struct {
+	// Loaded is true once the first reload has finished.
+	Loaded bool
+	// LastReload is when the most recent reload finished, and
+	// LastReloadDuration is how long it took. Both are zero if no reload
+	// has finished.
+	LastReload         time.Time
+	LastReloadDuration time.Duration
+	// Runs maps each run name to the progress of reading its event files.
+	Runs map[string]run.Progress
+}
+
+// Status returns the current progress of the loader. May be called
+// concurrently with Reload and with reads, so it can report progress of a
+// reload that's under way.
+func (ll *Loader) Status() Status {
+	ll.mu.RLock()
+	defer ll.mu.RUnlock()
+	result := Status{
+		LastReload:         ll.lastReload,
+		LastReloadDuration: ll.lastReloadDuration,
+		Runs:               make(map[string]run.Progress, len(ll.readers)),
+	}
+	select {
+	case <-ll.loaded:
+		result.Loaded = true
+	default:
+	}
+	for k, rr := range ll.readers {
+		result.Runs[k] = rr.Progress()
+	}
+	return result
+}
+
+// Reloaded returns a channel that is closed when the next reload finishes.
+// To avoid missing data, call Reloaded before reading from the runs, then wait
+// on the channel. Since accumulators ingest data asynchronously, a value read
+// near the end of a reload may only become visible shortly after the channel
+// is closed.
+func (ll *Loader) Reloaded() <-chan struct{} {
+	ll.mu.RLock()
+	defer ll.mu.RUnlock()
+	return ll.reloaded
+}
+
+// Snapshot returns a snapshot of all runs, which can be passed to
+// LoaderBuilder to resume loading later. Each run's state is as of the end of
+// a recent reload; since runs ingest data asynchronously, this may lag the
+// latest reload. Runs that haven't finished a reload are omitted, unless a
+// canceled reload stopped them partway. May be called concurrently with Reload
+// and with reads.
+func (ll *Loader) Snapshot() *snpb.LogdirSnapshot {
+	result := &snpb.LogdirSnapshot{Logdir: ll.logdir}
+	runs := ll.Runs()
+	names := make([]string, 0, len(runs))
+	for name := range runs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rs := runs[name].Snapshot()
+		if rs == nil {
+			continue
+		}
+		rs.RunName = name
+		result.Runs = append(result.Runs, rs)
+	}
+	return result
 }
 
 // Reload polls the log directory and reloads runs. It blocks until the reload
-// finishes. Must not be called concurrently with any other Reload. May be
-// called concurrently with reads.
-func (ll *Loader) Reload() {
-	ll.reload <- struct{}{}
+// finishes or, if ctx is canceled, until each run has finished its current
+// turn. A canceled reload doesn't count as finished for Loaded and Reloaded,
+// but the progress of each run is still included in later snapshots. Must not
+// be called concurrently with any other Reload. May be called concurrently
+// with reads.
+func (ll *Loader) Reload(ctx context.Context) {
+	ll.reload <- ctx
 	<-ll.asleep
 }
 
-// Close implements io.Closer. If there are multiple errors when closing
-// underlying run readers, an arbitrary one is returned.
+// Close implements io.Closer. It stops the loading goroutine and closes all
+// run readers, which closes their underlying files and stops their goroutines.
+// If there are multiple errors when closing underlying run readers, an
+// arbitrary one is returned. Must not be called concurrently with Reload, and
+// the loader must not be reloaded after it is closed. May be called
+// concurrently with reads, which will see no runs after Close returns.
 func (ll *Loader) Close() error {
+	close(ll.reload)
+
 	ll.mu.Lock()
 	defer ll.mu.Unlock()
 
 	ll.data = nil // gc
 	var firstErr error
-	for _, rr := range ll.readers {
+	for k, rr := range ll.readers {
+		reloadDuration.DeleteLabelValues(ll.logdir, k)
 		err := rr.Close()
 		if firstErr == nil {
 			firstErr = err
 		}
 	}
+	ll.readers = nil
 	return firstErr
 }
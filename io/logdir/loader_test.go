@@ -0,0 +1,201 @@
+package logdir
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wchargin/tensorboard-data-server/fs"
+	"github.com/wchargin/tensorboard-data-server/io/run"
+)
+
+// reloadWithTimeout calls ll.Reload and fails the test if it doesn't return.
+func reloadWithTimeout(t *testing.T, ll *Loader) {
+	done := make(chan struct{})
+	go func() {
+		ll.Reload(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Reload: still running after 5s")
+	}
+}
+
+func TestLoaderMissingLogdir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logdir_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(dir)
+
+	ll := LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	defer ll.Close()
+	reloadWithTimeout(t, ll)
+	if runs := ll.Runs(); len(runs) != 0 {
+		t.Errorf("Runs(): got %v, want empty", runs)
+	}
+}
+
+func TestLoaderClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logdir_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, run := range []string{"train", "eval"} {
+		if err := os.Mkdir(filepath.Join(dir, run), 0755); err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, run, "events.out.tfevents.123.myhost")
+		if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ll := LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	reloadWithTimeout(t, ll)
+	if got, want := len(ll.Runs()), 2; got != want {
+		t.Errorf("len(Runs()): got %v, want %v", got, want)
+	}
+	if err := ll.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if runs := ll.Runs(); len(runs) != 0 {
+		t.Errorf("Runs() after Close: got %v, want empty", runs)
+	}
+	if acc := ll.Run("train"); acc != nil {
+		t.Errorf(`Run("train") after Close: got %v, want nil`, acc)
+	}
+}
+
+func TestLoaderConcurrencyLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logdir_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// One run is big enough to need several turns, so the others must
+	// take turns with it rather than wait for it.
+	sizes := map[string]int{"big": 3*reloadTurnRecords + 1, "a": 10, "b": 0, "c": 1}
+	for name, n := range sizes {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		steps := make([]int64, n)
+		for i := range steps {
+			steps[i] = int64(i)
+		}
+		for i, base := range []string{"events.out.tfevents.1.myhost", "events.out.tfevents.2.myhost"} {
+			file := filepath.Join(dir, name, base)
+			half := steps[i*len(steps)/2 : (i+1)*len(steps)/2]
+			if err := ioutil.WriteFile(file, scalarRecords(t, half...), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	ll := LoaderBuilder{
+		FS:                   fs.OS{},
+		Logdir:               dir,
+		SamplesPerPlugin:     run.SamplesPerPlugin{"scalars": 0},
+		MaxConcurrentReloads: 2,
+		MaxConcurrentOpens:   1,
+	}.Start()
+	defer ll.Close()
+	reloadWithTimeout(t, ll)
+	for name, n := range sizes {
+		if n == 0 {
+			continue
+		}
+		waitSteps(t, ll, name, n)
+	}
+	if got, want := len(ll.Runs()), len(sizes); got != want {
+		t.Errorf("len(Runs()): got %v, want %v", got, want)
+	}
+}
+
+func TestLoaderReloadCanceled(t *testing.T) {
+	mfs := &fs.Mem{}
+	steps := make([]int64, 2*reloadTurnRecords)
+	for i := range steps {
+		steps[i] = int64(i)
+	}
+	records := scalarRecords(t, steps...)
+	mfs.Append("logs/train/events.out.tfevents.1.myhost", records)
+
+	ll := LoaderBuilder{
+		FS:               mfs,
+		Logdir:           "logs",
+		SamplesPerPlugin: run.SamplesPerPlugin{"scalars": 0},
+	}.Start()
+	defer ll.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ll.Reload(ctx)
+	select {
+	case <-ll.Loaded():
+		t.Errorf("Loaded() after canceled reload: closed, want open")
+	default:
+	}
+
+	// The run stops after one turn, but its progress can be snapshotted.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		snap := ll.Snapshot()
+		if len(snap.Runs) == 1 {
+			files := snap.Runs[0].Files
+			if len(files) != 1 || files[0].Offset == 0 || files[0].Offset == int64(len(records)) {
+				t.Errorf("snapshot after canceled reload: got files %v, want one partly read", files)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no snapshot of canceled reload after 5s: got %v", snap)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	reloadWithTimeout(t, ll)
+	<-ll.Loaded()
+	waitSteps(t, ll, "train", len(steps))
+}
+
+func TestLoaderMem(t *testing.T) {
+	mfs := &fs.Mem{}
+	mfs.Append("logs/train/events.out.tfevents.1.myhost", scalarRecords(t, 0, 1))
+	mfs.Append("logs/eval/nested/events.out.tfevents.1.myhost", scalarRecords(t, 0))
+	mfs.Append("logs/eval/notes.txt", []byte("not a run"))
+	mfs.Append("logs2/other/events.out.tfevents.1.myhost", scalarRecords(t, 0))
+
+	ll := LoaderBuilder{
+		FS:               mfs,
+		Logdir:           "logs",
+		SamplesPerPlugin: run.SamplesPerPlugin{"scalars": 0},
+	}.Start()
+	defer ll.Close()
+	reloadWithTimeout(t, ll)
+	runs := ll.Runs()
+	_, train := runs["train"]
+	_, eval := runs["eval/nested"]
+	if !train || !eval || len(runs) != 2 {
+		t.Errorf("Runs(): got %v, want train and eval/nested", runs)
+	}
+	waitSteps(t, ll, "train", 2)
+
+	// Growth should be picked up on the next reload, and runs whose files
+	// are all gone should be removed.
+	mfs.Append("logs/train/events.out.tfevents.1.myhost", scalarRecords(t, 2))
+	if err := mfs.Delete("logs/eval/nested/events.out.tfevents.1.myhost"); err != nil {
+		t.Fatal(err)
+	}
+	reloadWithTimeout(t, ll)
+	waitSteps(t, ll, "train", 3)
+	if runs := ll.Runs(); len(runs) != 1 {
+		t.Errorf("Runs() after deletion: got %v, want just train", runs)
+	}
+}
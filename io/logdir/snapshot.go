@@ -0,0 +1,55 @@
+package logdir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/protobuf/proto"
+
+	snpb "github.com/wchargin/tensorboard-data-server/proto/snapshot_proto"
+)
+
+// WriteSnapshot writes a snapshot to a file on the local filesystem,
+// replacing any existing file. The write is atomic: readers of the path see
+// either the old snapshot or the new one, never a partial file.
+func WriteSnapshot(path string, snap *snpb.LogdirSnapshot) error {
+	data, err := proto.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot. If the file does not
+// exist, the error satisfies os.IsNotExist.
+func ReadSnapshot(path string) (*snpb.LogdirSnapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	snap := &snpb.LogdirSnapshot{}
+	if err := proto.Unmarshal(data, snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
@@ -0,0 +1,147 @@
+package logdir
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	spb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/summary_go_proto"
+	epb "github.com/tensorflow/tensorflow/tensorflow/go/core/util/event_go_proto"
+	"github.com/wchargin/tensorboard-data-server/fs"
+	tbio "github.com/wchargin/tensorboard-data-server/io"
+	"github.com/wchargin/tensorboard-data-server/summary"
+)
+
+func scalarRecords(t *testing.T, steps ...int64) []byte {
+	var buf bytes.Buffer
+	for _, step := range steps {
+		data, err := proto.Marshal(&epb.Event{
+			Step:     step,
+			WallTime: float64(1000 + step),
+			What: &epb.Event_Summary{Summary: &spb.Summary{
+				Value: []*spb.Summary_Value{summary.Scalar("loss", float64(step))},
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		record := tbio.NewTFRecord(data)
+		record.Write(&buf)
+	}
+	return buf.Bytes()
+}
+
+// waitSteps waits until the "loss" time series in the given run has exactly
+// the given number of points.
+func waitSteps(t *testing.T, ll *Loader, run string, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if acc := ll.Run(run); acc != nil && len(acc.Sample("loss")) == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %q: no %v points after 5s", run, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLoaderSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logdir_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "train"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "train", "events.out.tfevents.123.myhost")
+	if err := ioutil.WriteFile(file, scalarRecords(t, 0, 1, 2), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ll := LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	reloadWithTimeout(t, ll)
+	waitSteps(t, ll, "train", 3)
+	// Reload again so that the snapshot reflects all data: accumulators
+	// ingest checkpoints asynchronously, so a snapshot may lag by one
+	// reload.
+	reloadWithTimeout(t, ll)
+	snap := ll.Snapshot()
+	if err := ll.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Runs) != 1 || snap.Runs[0].RunName != "train" {
+		t.Fatalf("Snapshot: got %v, want one run %q", snap, "train")
+	}
+
+	path := filepath.Join(dir, "snapshot")
+	if err := WriteSnapshot(path, snap); err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+	got, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatalf("ReadSnapshot: %v", err)
+	}
+	if !proto.Equal(got, snap) {
+		t.Errorf("ReadSnapshot: got %v, want %v", got, snap)
+	}
+	if _, err := ReadSnapshot(filepath.Join(dir, "nonexistent")); !os.IsNotExist(err) {
+		t.Errorf("ReadSnapshot(nonexistent): got %v, want not-exist error", err)
+	}
+
+	// Clobber the data that's already been read, then append more. A
+	// restored loader should see neither the clobbered data nor errors.
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents = append(make([]byte, len(contents)), scalarRecords(t, 3)...)
+	if err := ioutil.WriteFile(file, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ll = LoaderBuilder{FS: fs.OS{}, Logdir: dir, Snapshot: got}.Start()
+	defer ll.Close()
+	reloadWithTimeout(t, ll)
+	waitSteps(t, ll, "train", 4)
+	if errs, n := ll.Run("train").LoadErrors(); n != 0 {
+		t.Errorf("LoadErrors: got %v, want none", errs)
+	}
+}
+
+func TestLoaderSnapshotOtherLogdir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logdir_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "train"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "train", "events.out.tfevents.123.myhost")
+	if err := ioutil.WriteFile(file, scalarRecords(t, 0, 1, 2), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ll := LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	reloadWithTimeout(t, ll)
+	reloadWithTimeout(t, ll)
+	snap := ll.Snapshot()
+	ll.Close()
+	snap.Logdir = "/some/other/logdir"
+
+	// The snapshot should be ignored, so all data is read from scratch.
+	ll = LoaderBuilder{FS: fs.OS{}, Logdir: dir, Snapshot: snap}.Start()
+	defer ll.Close()
+	if err := ioutil.WriteFile(file, scalarRecords(t, 0, 1, 2, 3), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reloadWithTimeout(t, ll)
+	waitSteps(t, ll, "train", 4)
+}
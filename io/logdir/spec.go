@@ -0,0 +1,36 @@
+package logdir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseSpec parses a comma-separated list of "name:path" pairs, like
+// "mnist:/tmp/mnist,cifar:gs://bucket/cifar", into a map from experiment name
+// to log directory. Names must be non-empty and unique, and may not contain
+// colons; paths may. The empty string yields an empty map.
+func ParseSpec(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return result, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("logdir spec: %q: want \"name:path\"", item)
+		}
+		name, path := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if name == "" {
+			return nil, fmt.Errorf("logdir spec: %q: empty name", item)
+		}
+		if path == "" || strings.HasPrefix(path, "//") {
+			// The latter catches URLs like "gs://bucket" with no name.
+			return nil, fmt.Errorf("logdir spec: %q: want \"name:path\"", item)
+		}
+		if _, ok := result[name]; ok {
+			return nil, fmt.Errorf("logdir spec: duplicate name %q", name)
+		}
+		result[name] = path
+	}
+	return result, nil
+}
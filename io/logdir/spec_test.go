@@ -0,0 +1,33 @@
+package logdir
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	cases := []struct {
+		input string
+		want  map[string]string
+	}{
+		{"", map[string]string{}},
+		{"mnist:/tmp/mnist", map[string]string{"mnist": "/tmp/mnist"}},
+		{
+			"mnist:/tmp/mnist, cifar:gs://bucket/cifar",
+			map[string]string{"mnist": "/tmp/mnist", "cifar": "gs://bucket/cifar"},
+		},
+		{"relative:logs/run:1", map[string]string{"relative": "logs/run:1"}},
+	}
+	for _, c := range cases {
+		got, err := ParseSpec(c.input)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseSpec(%q): got %v, %v; want %v, nil", c.input, got, err, c.want)
+		}
+	}
+
+	for _, input := range []string{"/tmp/mnist", ":/tmp/mnist", "mnist:", "gs://bucket/mnist", "a:/x,a:/y", "a:/x,"} {
+		if got, err := ParseSpec(input); err == nil {
+			t.Errorf("ParseSpec(%q): got %v, nil; want error", input, got)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package run
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	spb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/summary_go_proto"
 	"github.com/wchargin/tensorboard-data-server/mem"
@@ -11,16 +14,23 @@ import (
 
 // NewAccumulator creates an Accumulator from a Reader's output channel and
 // starts a goroutine to ingest data. The caller is still in charge of calling
-// reader.Reload to wake up the reader.
-func NewAccumulator(reader *Reader) *Accumulator {
-	acc := &Accumulator{
+// reader.Reload to wake up the reader. The spp argument configures reservoir
+// capacities, and may be nil to use defaults for all plugins.
+func NewAccumulator(reader *Reader, spp SamplesPerPlugin) *Accumulator {
+	acc := newAccumulator(reader, spp)
+	go acc.start()
+	return acc
+}
+
+// newAccumulator creates an accumulator without starting its goroutine.
+func newAccumulator(reader *Reader, spp SamplesPerPlugin) *Accumulator {
+	return &Accumulator{
 		run:  reader.dir,
 		c:    reader.Out,
+		spp:  spp,
 		mds:  make(mem.MetadataStore),
 		data: make(map[string]mem.EagerReservoir),
 	}
-	go acc.start()
-	return acc
 }
 
 // An Accumulator maintains metadata and reservoir-sampled data for all time
@@ -31,17 +41,38 @@ type Accumulator struct {
 	// c is the input channel for events, which is expected to be the
 	// output channel of a run.Reader.
 	c <-chan ValueResult
+	// spp configures reservoir capacities for new time series.
+	spp SamplesPerPlugin
 
-	// mu locks mds and data. mu is always held while data[_] accessed:
-	// i.e., mu precedes the internal lock of data[_] in the total lock
-	// ordering.
+	// mu locks mds, data, startTime, the load error log, state, and dirty.
+	// mu is always held while data[_] accessed: i.e., mu precedes the
+	// internal lock of data[_] in the total lock ordering.
 	mu sync.Mutex
 	// mds holds the first SummaryMetadata for each seen tag.
 	mds mem.MetadataStore
 	// data maps from tag name to reservoir of values for that time series.
 	data map[string]mem.EagerReservoir
+	// startTime is the smallest wall time of any event seen so far,
+	// including events with no summary values. Only valid if
+	// hasStartTime.
+	startTime    float64
+	hasStartTime bool
+	// loadErrors holds the most recent load errors, oldest first, up to
+	// maxLoadErrors of them. numLoadErrors counts all load errors ever
+	// seen, including those evicted from loadErrors.
+	loadErrors    []LoadError
+	numLoadErrors int
+	// state is the state of the accumulator as of the most recent
+	// checkpoint from its reader, or nil if there hasn't been one. It's
+	// immutable once set.
+	state *accumulatorState
+	// dirty is set when data is ingested after the most recent checkpoint.
+	dirty bool
 }
 
+// maxLoadErrors is the number of load errors retained per run.
+const maxLoadErrors = 100
+
 // Step implements the StepIndexed interface.
 func (d ValueDatum) Step() mem.Step {
 	return d.EventStep
@@ -50,9 +81,13 @@ func (d ValueDatum) Step() mem.Step {
 // start runs in its own goroutine, created by NewAccumulator.
 func (acc *Accumulator) start() {
 	for dr := range acc.c {
+		if dr.Checkpoint != nil {
+			acc.ingestCheckpoint(dr.Checkpoint)
+			continue
+		}
 		if dr.Err != nil {
-			// Swallow errors and print to console.
-			fmt.Fprintln(os.Stderr, dr.Err)
+			fmt.Fprintf(os.Stderr, "run %q: %v\n", acc.run, dr.Err)
+			acc.ingestError(dr.Err)
 			continue
 		}
 		datum := dr.Datum
@@ -64,17 +99,22 @@ func (acc *Accumulator) start() {
 	}
 }
 
-// ingestDatum adds non-nil datum to the accumulator.
+// ingestDatum adds non-nil datum to the accumulator. If the datum has no
+// value, only its wall time is recorded.
 func (acc *Accumulator) ingestDatum(datum *ValueDatum) {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+
+	acc.dirty = true
+	if !acc.hasStartTime || datum.EventWallTime < acc.startTime {
+		acc.startTime = datum.EventWallTime
+		acc.hasStartTime = true
+	}
 	if datum.Value == nil {
-		fmt.Fprintf(os.Stderr, "run %q: skipping empty value at step %d\n", acc.run, datum.EventStep)
 		return
 	}
 	tag := datum.Value.Tag
 
-	acc.mu.Lock()
-	defer acc.mu.Unlock()
-
 	var md *spb.SummaryMetadata
 	{
 		var ok bool
@@ -91,12 +131,31 @@ func (acc *Accumulator) ingestDatum(datum *ValueDatum) {
 	}
 	rsv, ok := acc.data[tag]
 	if !ok {
-		rsv = mem.NewEagerReservoir(reservoirCapacity(md.DataClass))
+		rsv = mem.NewEagerReservoir(acc.spp.capacity(md))
 		acc.data[tag] = rsv
 	}
 	rsv.Offer(*datum)
 }
 
+// ingestError records a non-nil error in the load error log, evicting the
+// oldest entry if the log is full.
+func (acc *Accumulator) ingestError(err error) {
+	var le LoadError
+	if p, ok := err.(*LoadError); ok {
+		le = *p
+	} else {
+		le = LoadError{Offset: -1, Time: time.Now(), Err: err}
+	}
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	acc.numLoadErrors++
+	if len(acc.loadErrors) == maxLoadErrors {
+		copy(acc.loadErrors, acc.loadErrors[1:])
+		acc.loadErrors = acc.loadErrors[:maxLoadErrors-1]
+	}
+	acc.loadErrors = append(acc.loadErrors, le)
+}
+
 // List lists all tags with their summary metadata.
 func (acc *Accumulator) List() mem.MetadataStore {
 	result := make(mem.MetadataStore)
@@ -137,6 +196,19 @@ func (acc *Accumulator) Sample(tag string) []ValueDatum {
 	return result
 }
 
+// Version returns the version of the reservoir for the given time series, or
+// the zero version if no data has been seen. Callers that have already sampled
+// a time series need not sample it again until its version changes.
+func (acc *Accumulator) Version(tag string) mem.ReservoirVersion {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	rsv, ok := acc.data[tag]
+	if !ok {
+		return mem.ReservoirVersion{}
+	}
+	return rsv.Version()
+}
+
 // Last returns the last value stored for the given time series, or nil if no
 // data has been seen.
 func (acc *Accumulator) Last(tag string) *ValueDatum {
@@ -156,6 +228,81 @@ func (acc *Accumulator) Last(tag string) *ValueDatum {
 	return &lastDatum
 }
 
+// Occupancy returns the number of values currently stored for each time series,
+// keyed by tag.
+func (acc *Accumulator) Occupancy() map[string]int {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	result := make(map[string]int, len(acc.data))
+	for tag, rsv := range acc.data {
+		result[tag] = rsv.Len()
+	}
+	return result
+}
+
+// StartTime returns the smallest wall time of any event seen in this run, as
+// floating-point seconds since epoch. The second return value is false if no
+// events have been seen yet.
+func (acc *Accumulator) StartTime() (float64, bool) {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	return acc.startTime, acc.hasStartTime
+}
+
+// LoadErrors returns the most recent errors encountered while loading this run,
+// oldest first, along with the total number of errors seen so far. Only a
+// bounded number of errors are retained, so the total may exceed the length of
+// the returned slice.
+func (acc *Accumulator) LoadErrors() ([]LoadError, int) {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	result := make([]LoadError, len(acc.loadErrors))
+	copy(result, acc.loadErrors)
+	return result, acc.numLoadErrors
+}
+
+// SamplesPerPlugin maps plugin names to reservoir capacities: i.e., the number
+// of points to keep per time series. A capacity of zero means to keep all
+// points. Time series whose plugins are not in the map use a default capacity
+// based on their data class. A nil SamplesPerPlugin uses defaults for all
+// plugins.
+type SamplesPerPlugin map[string]uint64
+
+// ParseSamplesPerPlugin parses a comma-separated list of "plugin=capacity"
+// pairs, like "scalars=5000,images=0", as accepted by TensorBoard's
+// --samples_per_plugin flag. The empty string yields an empty map.
+func ParseSamplesPerPlugin(s string) (SamplesPerPlugin, error) {
+	result := make(SamplesPerPlugin)
+	if strings.TrimSpace(s) == "" {
+		return result, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("samples per plugin: %q: want \"plugin=capacity\"", item)
+		}
+		plugin := strings.TrimSpace(kv[0])
+		if plugin == "" {
+			return nil, fmt.Errorf("samples per plugin: %q: empty plugin name", item)
+		}
+		capacity, err := strconv.ParseUint(strings.TrimSpace(kv[1]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("samples per plugin: %q: %v", item, err)
+		}
+		result[plugin] = capacity
+	}
+	return result, nil
+}
+
+// capacity returns the reservoir capacity for a time series with the given
+// (non-nil) initial summary metadata.
+func (spp SamplesPerPlugin) capacity(md *spb.SummaryMetadata) uint64 {
+	if capacity, ok := spp[md.PluginData.GetPluginName()]; ok {
+		return capacity
+	}
+	return reservoirCapacity(md.DataClass)
+}
+
 func reservoirCapacity(dc spb.DataClass) uint64 {
 	switch dc {
 	case spb.DataClass_DATA_CLASS_SCALAR:
@@ -0,0 +1,143 @@
+package run
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	spb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/summary_go_proto"
+	"github.com/wchargin/tensorboard-data-server/mem"
+)
+
+func newTestAccumulator() *Accumulator {
+	return &Accumulator{
+		run:  "test",
+		mds:  make(mem.MetadataStore),
+		data: make(map[string]mem.EagerReservoir),
+	}
+}
+
+func TestAccumulatorStartTime(t *testing.T) {
+	acc := newTestAccumulator()
+	if got, ok := acc.StartTime(); ok {
+		t.Errorf("initial StartTime(): got %v, true; want _, false", got)
+	}
+
+	// A value-less datum, as from a file_version event.
+	acc.ingestDatum(&ValueDatum{EventStep: 0, EventWallTime: 1234.5})
+	if got, ok := acc.StartTime(); got != 1234.5 || !ok {
+		t.Errorf("StartTime() after file_version: got %v, %v; want %v, true", got, ok, 1234.5)
+	}
+	if got := acc.List(); len(got) != 0 {
+		t.Errorf("List() after file_version: got %v, want empty", got)
+	}
+
+	value := &spb.Summary_Value{
+		Tag: "loss",
+		Metadata: &spb.SummaryMetadata{
+			DataClass: spb.DataClass_DATA_CLASS_SCALAR,
+		},
+	}
+	acc.ingestDatum(&ValueDatum{EventStep: 1, EventWallTime: 2345.5, Value: value})
+	if got, ok := acc.StartTime(); got != 1234.5 || !ok {
+		t.Errorf("StartTime() after later event: got %v, %v; want %v, true", got, ok, 1234.5)
+	}
+	acc.ingestDatum(&ValueDatum{EventStep: 2, EventWallTime: 1000.25, Value: value})
+	if got, ok := acc.StartTime(); got != 1000.25 || !ok {
+		t.Errorf("StartTime() after earlier event: got %v, %v; want %v, true", got, ok, 1000.25)
+	}
+	if got := len(acc.Sample("loss")); got != 2 {
+		t.Errorf(`len(Sample("loss")): got %v, want 2`, got)
+	}
+}
+
+func TestParseSamplesPerPlugin(t *testing.T) {
+	cases := []struct {
+		input string
+		want  SamplesPerPlugin
+	}{
+		{"", SamplesPerPlugin{}},
+		{"scalars=5000", SamplesPerPlugin{"scalars": 5000}},
+		{"scalars=5000,images=0", SamplesPerPlugin{"scalars": 5000, "images": 0}},
+		{" scalars = 1 , images=2", SamplesPerPlugin{"scalars": 1, "images": 2}},
+	}
+	for _, c := range cases {
+		got, err := ParseSamplesPerPlugin(c.input)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseSamplesPerPlugin(%q): got %v, %v; want %v, nil", c.input, got, err, c.want)
+		}
+	}
+
+	for _, input := range []string{"scalars", "=5", "scalars=-1", "scalars=many", "scalars=1,"} {
+		if got, err := ParseSamplesPerPlugin(input); err == nil {
+			t.Errorf("ParseSamplesPerPlugin(%q): got %v, nil; want error", input, got)
+		}
+	}
+}
+
+func TestAccumulatorSamplesPerPlugin(t *testing.T) {
+	acc := newTestAccumulator()
+	acc.spp = SamplesPerPlugin{"scalars": 0, "custom": 3}
+
+	metadata := func(pluginName string, dc spb.DataClass) *spb.SummaryMetadata {
+		return &spb.SummaryMetadata{
+			PluginData: &spb.SummaryMetadata_PluginData{PluginName: pluginName},
+			DataClass:  dc,
+		}
+	}
+	mds := map[string]*spb.SummaryMetadata{
+		"loss":   metadata("scalars", spb.DataClass_DATA_CLASS_SCALAR),
+		"custom": metadata("custom", spb.DataClass_DATA_CLASS_SCALAR),
+		"images": metadata("images", spb.DataClass_DATA_CLASS_BLOB_SEQUENCE),
+	}
+	for step := 0; step < 2000; step++ {
+		for tag, md := range mds {
+			value := &spb.Summary_Value{Tag: tag}
+			if step == 0 {
+				value.Metadata = md
+			}
+			acc.ingestDatum(&ValueDatum{EventStep: mem.Step(step), Value: value})
+		}
+	}
+
+	wantLens := map[string]int{
+		"loss":   2000, // unbounded
+		"custom": 3,    // configured
+		"images": 10,   // default for blob sequences
+	}
+	for tag, want := range wantLens {
+		if got := len(acc.Sample(tag)); got != want {
+			t.Errorf("len(Sample(%q)): got %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestAccumulatorLoadErrors(t *testing.T) {
+	acc := newTestAccumulator()
+	if errs, total := acc.LoadErrors(); len(errs) != 0 || total != 0 {
+		t.Errorf("initial LoadErrors(): got %v, %v; want empty, 0", errs, total)
+	}
+
+	n := maxLoadErrors + 5
+	for i := 0; i < n; i++ {
+		acc.ingestError(newLoadError("events", int64(i), LoadErrorParse, errors.New("bad")))
+	}
+	// A plain error, which shouldn't happen but should still be recorded.
+	acc.ingestError(errors.New("mystery"))
+	n++
+
+	errs, total := acc.LoadErrors()
+	if total != n {
+		t.Errorf("total: got %v, want %v", total, n)
+	}
+	if got, want := len(errs), maxLoadErrors; got != want {
+		t.Fatalf("len(errs): got %v, want %v", got, want)
+	}
+	if got, want := errs[0].Offset, int64(n-maxLoadErrors); got != want {
+		t.Errorf("oldest retained error: Offset: got %v, want %v", got, want)
+	}
+	last := errs[len(errs)-1]
+	if last.Kind != LoadErrorUnknown || last.Offset != -1 || last.Err.Error() != "mystery" {
+		t.Errorf("newest error: got %+v, want unknown error %q", last, "mystery")
+	}
+}
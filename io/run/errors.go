@@ -0,0 +1,74 @@
+package run
+
+import (
+	"fmt"
+	"time"
+)
+
+// A LoadErrorKind classifies a LoadError.
+type LoadErrorKind int
+
+const (
+	// LoadErrorUnknown is the zero value of LoadErrorKind.
+	LoadErrorUnknown LoadErrorKind = iota
+	// LoadErrorIO indicates a failure to list the run directory or to open
+	// an event file.
+	LoadErrorIO
+	// LoadErrorDataLoss indicates a record whose data failed its checksum,
+	// or, when recovering from corrupt records, a range of corrupt bytes.
+	// The data is skipped, and reading continues.
+	LoadErrorDataLoss
+	// LoadErrorParse indicates a record that does not hold a valid Event
+	// proto. The record is skipped, and reading continues.
+	LoadErrorParse
+	// LoadErrorFatal indicates an error that stops reading an event file,
+	// such as a record whose length failed its checksum. No more data will
+	// be read from the file.
+	LoadErrorFatal
+)
+
+// String returns a short snake-case name for the kind, like "data_loss".
+func (k LoadErrorKind) String() string {
+	switch k {
+	case LoadErrorIO:
+		return "io"
+	case LoadErrorDataLoss:
+		return "data_loss"
+	case LoadErrorParse:
+		return "parse"
+	case LoadErrorFatal:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+// A LoadError describes a failure to read part of a run.
+type LoadError struct {
+	// File is the path to the event file that failed, or to the run
+	// directory if the directory itself could not be listed.
+	File string
+	// Offset is the byte offset within File of the start of the record
+	// that failed, or -1 if the error is not tied to a record.
+	Offset int64
+	Kind   LoadErrorKind
+	// Time is when the error was observed.
+	Time time.Time
+	Err  error
+}
+
+func newLoadError(file string, offset int64, kind LoadErrorKind, err error) *LoadError {
+	return &LoadError{File: file, Offset: offset, Kind: kind, Time: time.Now(), Err: err}
+}
+
+func (e *LoadError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("%s: %v error: %v", e.File, e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%s at offset %d: %v error: %v", e.File, e.Offset, e.Kind, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
@@ -3,14 +3,56 @@ package run
 import (
 	"bufio"
 	"io"
+	"io/ioutil"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	spb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/summary_go_proto"
 	epb "github.com/tensorflow/tensorflow/tensorflow/go/core/util/event_go_proto"
 	"github.com/wchargin/tensorboard-data-server/fs"
+	tbio "github.com/wchargin/tensorboard-data-server/io"
 	"github.com/wchargin/tensorboard-data-server/io/eventfile"
 	"github.com/wchargin/tensorboard-data-server/mem"
+	"github.com/wchargin/tensorboard-data-server/metrics"
+)
+
+// Per-event-file metrics are aggregated by log directory, so that there are a
+// bounded number of series. Series are never deleted, since readers in loaders
+// for the same log directory share them.
+var (
+	eventFileBytesRead = promauto.With(metrics.Default).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "event_file_bytes_read_total",
+		Help:      "Number of bytes read from event files, by log directory.",
+	}, []string{"logdir"})
+	eventFileRecordsRead = promauto.With(metrics.Default).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "event_file_records_read_total",
+		Help:      "Number of records read from event files, including bad records, by log directory.",
+	}, []string{"logdir"})
+	eventFilesOpen = promauto.With(metrics.Default).NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Name:      "event_files_open",
+		Help:      "Number of event files held open, across all runs.",
+	})
+	eventFileRewrites = promauto.With(metrics.Default).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "event_file_rewrites_total",
+		Help:      "Number of times an event file was found truncated or replaced, and read again from the start, by log directory.",
+	}, []string{"logdir"})
+	eventFileErrors = promauto.With(metrics.Default).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Name:      "event_file_errors_total",
+		Help:      "Number of errors reading event files, by log directory and kind: \"data_loss\" for checksum failures, \"parse\" for other bad records, or \"fatal\" for errors that stop reading a file.",
+	}, []string{"logdir", "kind"})
 )
 
 // eventFileInfix appears in a file name if and only if that file is an event
@@ -18,18 +60,32 @@ import (
 const eventFileInfix = "tfevents"
 
 // A ValueDatum holds a Summary.Value protobuf with the step and wall time from
-// the enclosing event.
+// the enclosing event. Value may be nil if the enclosing event had no summary
+// values (e.g., a file_version event); such a datum is still sent so that
+// consumers can observe the event's wall time.
 type ValueDatum struct {
 	EventStep     mem.Step
 	EventWallTime float64
 	Value         *spb.Summary_Value
 }
 
-// A ValueResult is either a non-nil Datum plus a nil Err or a nil Datum plus a
-// non-nil Err.
+// A ValueResult has exactly one of Datum, Err, and Checkpoint non-nil. A
+// non-nil Err is always a *LoadError.
 type ValueResult struct {
-	Datum *ValueDatum
-	Err   error
+	Datum      *ValueDatum
+	Err        error
+	Checkpoint *Checkpoint
+}
+
+// A Checkpoint records how far a Reader has read. The reader sends one at the
+// end of each reload, after all values and errors from that reload, and when
+// asked by Reader.Checkpoint.
+type Checkpoint struct {
+	// Offsets maps each event file that has been opened to the byte offset
+	// just past the last complete record read from it.
+	Offsets map[string]int64
+	// Metadata is a copy of the reader's MetadataStore.
+	Metadata mem.MetadataStore
 }
 
 // ReaderBuilder specifies options for a Reader.
@@ -38,21 +94,75 @@ type ReaderBuilder struct {
 	FS fs.Filesystem
 	// Dir is the directory being loaded, as a path under FS.
 	Dir string
+	// Logdir is the log directory containing Dir, used only to label
+	// metrics. It's optional.
+	Logdir string
 
 	// BufSize controls the size of the reader buffer on the underlying
 	// event file. It's optional; zero means to use a default.
 	BufSize int
 	// ChanBuf controls the buffer size on the output channel.
 	ChanBuf int
+
+	// InactiveAge is how long an event file may go without new records
+	// before it's closed. It's optional; zero means to never close files
+	// for inactivity.
+	InactiveAge time.Duration
+	// CloseSuperseded says to close each event file once a lexically
+	// greater (i.e., newer) event file exists in the directory.
+	CloseSuperseded bool
+	// Opens limits the number of concurrent file opens and stats, and may
+	// be shared among many readers. A file holds its slot only while it's
+	// being opened or statted, not for as long as it stays open. It's
+	// optional; nil means no limit.
+	Opens Semaphore
+	// RecoverCorruptRecords says to skip past corrupt records in event
+	// files rather than giving up on the rest of the file, as with
+	// eventfile.ReaderBuilder.Recover.
+	RecoverCorruptRecords bool
 }
 
 // Reader reads events from all event files in a directory and streams their
 // values after compatibility transformations. Call Reload while listening to
 // its Out channel.
+//
+// Event files may be compressed with gzip or zlib, as detected by
+// tbio.DetectCompression. Offsets in compressed files, as in checkpoints and
+// errors, are into the decompressed data.
 type Reader struct {
-	// Out is the output channel for values and errors.
+	// Out is the output channel for values and errors. It is closed when
+	// the reader is closed.
 	Out <-chan ValueResult
 	readerState
+
+	// progressMu locks progress, which unlike readerState may be accessed
+	// from any goroutine.
+	progressMu sync.Mutex
+	// progress maps each event file that has been opened to how much of
+	// it has been read.
+	progress map[string]fileProgress
+}
+
+// fileProgress describes how much of an event file has been read.
+type fileProgress struct {
+	// read is the offset just past the last complete record read.
+	read int64
+	// size is the size of the file as last observed, at least read.
+	size int64
+}
+
+// Progress describes how much of a run's event files has been read.
+type Progress struct {
+	// Files is the number of event files opened so far.
+	Files int
+	// BytesRead is the number of bytes read from event files, up to the
+	// end of the last complete record in each. For compressed files, it
+	// counts compressed bytes, including any that the decompressor has
+	// read ahead.
+	BytesRead int64
+	// TotalBytes is the total size of event files as last observed: when
+	// each was opened or last read. It's at least BytesRead.
+	TotalBytes int64
 }
 
 // Reader holds the internal state for a loading goroutine. All fields
@@ -62,11 +172,50 @@ type readerState struct {
 	fs fs.Filesystem
 	// dir is the directory being loaded, as a path under fs.
 	dir string
+	// logdir is ReaderBuilder.Logdir.
+	logdir string
 	// loaders is a map of stateful readers for open event files, or nil if
 	// a reader has been closed due to a fatal error.
 	loaders map[string]*eventfile.Reader
-	// fds is a map of underlying file descriptors that need to be closed.
-	fds map[string]fs.File
+	// fds is a map of underlying files that need to be closed: either
+	// fs.Files or, for compressed files, compressedFiles.
+	fds map[string]io.Closer
+	// offsets maps each file with a live loader to the byte offset just
+	// past the last complete record read from it.
+	offsets map[string]int64
+	// lastRead maps each file with a live loader to the time that it was
+	// opened or last yielded a record, whichever is later.
+	lastRead map[string]time.Time
+	// checked maps each file with a live loader to its offset when it was
+	// last checked for rewrites, or -1 if it hasn't been since it was
+	// opened. Files that have read past it since needn't be checked again
+	// yet.
+	checked map[string]int64
+	// dormant maps each event file that has been closed for inactivity to
+	// the offset from which to resume reading it. Dormant files have no
+	// entries in loaders or fds; they're reopened if they grow.
+	dormant map[string]int64
+	// infos maps each open or dormant event file to its description as of
+	// the last check for rewrites, if it could be statted.
+	infos map[string]fs.FileInfo
+	// compression maps each open or dormant event file to its compression
+	// format, once known.
+	compression map[string]tbio.Compression
+	// inactiveAge, closeSuperseded, opens, and recover are as on
+	// ReaderBuilder.
+	inactiveAge     time.Duration
+	closeSuperseded bool
+	opens           Semaphore
+	recover         bool
+	// inPass is true when a reload has started reading files but hasn't
+	// yet read them all, because it ran out of budget. Then, pending lists
+	// the files left to read, in order, and listed holds all event files
+	// found when the reload started. If awake is true, the loader for
+	// pending[0] has been woken and may be partway through its file.
+	inPass  bool
+	pending []string
+	listed  []string
+	awake   bool
 	// newBufioReader is a *bufio.Reader factory, either NewReader or a
 	// partially applied NewReaderSize.
 	newBufioReader func(io.Reader) *bufio.Reader
@@ -77,12 +226,12 @@ type readerState struct {
 	// Communication channels, described from the perspective of the
 	// loading goroutine (*Reader.start).
 
-	// reload is an input channel that sees unit when this loader should
-	// wake up.
-	reload chan struct{}
-	// asleep is an output channel that sees unit when this loader has read
-	// to EOF and gone to sleep, to be awoken later via "reload".
-	asleep chan struct{}
+	// reload is an input channel that sees a record budget when this
+	// loader should wake up, as for ReloadSome.
+	reload chan int
+	// asleep is an output channel that sees whether the reload finished
+	// when this loader has gone to sleep, to be awoken later via "reload".
+	asleep chan bool
 	// out is the output channel along which results will be sent.
 	out chan<- ValueResult
 }
@@ -90,6 +239,13 @@ type readerState struct {
 // Start starts a reader in a new goroutine. Once woken with a call to Reload,
 // it reads the full contents of the run directory, then goes to sleep again.
 func (b ReaderBuilder) Start() *Reader {
+	rr := b.newReader()
+	go rr.start()
+	return rr
+}
+
+// newReader creates a reader without starting its goroutine.
+func (b ReaderBuilder) newReader() *Reader {
 	newBufioReader := bufio.NewReader
 	bufSize := b.BufSize
 	if bufSize != 0 {
@@ -99,93 +255,438 @@ func (b ReaderBuilder) Start() *Reader {
 	st := readerState{
 		fs:             b.FS,
 		dir:            b.Dir,
+		logdir:         b.Logdir,
 		loaders:        make(map[string]*eventfile.Reader),
-		fds:            make(map[string]fs.File),
+		fds:            make(map[string]io.Closer),
+		offsets:        make(map[string]int64),
+		lastRead:       make(map[string]time.Time),
+		checked:        make(map[string]int64),
+		dormant:        make(map[string]int64),
+		infos:          make(map[string]fs.FileInfo),
+		compression:    make(map[string]tbio.Compression),
 		newBufioReader: newBufioReader,
 
+		inactiveAge:     b.InactiveAge,
+		closeSuperseded: b.CloseSuperseded,
+		opens:           b.Opens,
+		recover:         b.RecoverCorruptRecords,
+
 		mds: make(map[string]*spb.SummaryMetadata),
 		out: out,
 
-		reload: make(chan struct{}),
-		asleep: make(chan struct{}),
+		reload: make(chan int),
+		asleep: make(chan bool),
 	}
-	rr := &Reader{Out: out, readerState: st}
-	go rr.start()
-	return rr
+	return &Reader{Out: out, readerState: st, progress: make(map[string]fileProgress)}
 }
 
 func (rr *Reader) start() {
-	for range rr.reload {
-		rr.mkloaders()
-		filenames := make([]string, len(rr.loaders))
-		{
-			i := 0
-			for k := range rr.loaders {
-				filenames[i] = k
-				i++
-			}
+	defer close(rr.out)
+	for maxRecords := range rr.reload {
+		rr.asleep <- rr.reloadSome(maxRecords)
+	}
+}
+
+// reloadSome continues the current reload, or starts a new one, reading at
+// most maxRecords records if maxRecords is positive. It returns true if the
+// reload finished.
+func (rr *Reader) reloadSome(maxRecords int) bool {
+	if !rr.inPass {
+		rr.listed = rr.mkloaders()
+		rr.pending = make([]string, 0, len(rr.loaders))
+		for k := range rr.loaders {
+			rr.pending = append(rr.pending, k)
 		}
-		sort.Strings(filenames)
-		for _, fn := range filenames {
-			rr.readfrom(fn)
+		sort.Strings(rr.pending)
+		rr.inPass = true
+	}
+	var budget *int
+	if maxRecords > 0 {
+		budget = &maxRecords
+	}
+	for len(rr.pending) > 0 {
+		if !rr.readfrom(rr.pending[0], budget) {
+			return false
 		}
-		rr.asleep <- struct{}{}
+		rr.pending = rr.pending[1:]
 	}
+	rr.inPass = false
+	rr.closeInactive(rr.listed)
+	rr.listed = nil
+	rr.out <- ValueResult{Checkpoint: rr.checkpoint()}
+	return true
 }
 
 // mkloaders ensures that a loader exists for every event file in the run
-// directory. It sends zero or more error results along rr.out.
-func (rr *Reader) mkloaders() {
+// directory, except for dormant files that haven't grown. It returns the names
+// of all event files in the directory, in lexical order, and sends zero or
+// more error results along rr.out.
+func (rr *Reader) mkloaders() []string {
 	files, err := rr.fs.ListFiles(rr.dir)
 	if err != nil {
-		rr.out <- ValueResult{Err: err}
-		return
+		rr.out <- ValueResult{Err: newLoadError(rr.dir, -1, LoadErrorIO, err)}
+		return nil
 	}
+	var eventFiles []string
 	for _, file := range files {
 		if !strings.Contains(file, eventFileInfix) {
 			continue
 		}
+		eventFiles = append(eventFiles, file)
 		err := rr.mkloader(file)
 		if err != nil {
-			rr.out <- ValueResult{Err: err}
+			rr.out <- ValueResult{Err: newLoadError(file, -1, LoadErrorIO, err)}
 		}
 	}
+	return eventFiles
 }
 
 func (rr *Reader) mkloader(file string) error {
-	if _, ok := rr.loaders[file]; ok {
+	_, open := rr.loaders[file]
+	offset, dormant := rr.dormant[file]
+	if open {
+		offset = rr.offsets[file]
+		if checked := rr.checked[file]; checked >= 0 && offset != checked {
+			// It's read something since it was last checked, so
+			// it's not parked on a rewritten file.
+			rr.checked[file] = offset
+			return nil
+		}
+	}
+	prev, statted := rr.infos[file]
+	if statted {
+		info, err := rr.stat(file)
+		switch {
+		case err != nil:
+			// If it's gone for good, reading will fail.
+			statted = false
+		case rr.rewritten(file, prev, info, offset):
+			rr.forget(file)
+			eventFileRewrites.WithLabelValues(rr.logdir).Inc()
+			rr.infos[file] = info
+			open, dormant, offset, statted = false, false, 0, false
+		case open:
+			rr.infos[file] = info
+			rr.checked[file] = offset
+			return nil
+		default:
+			rr.infos[file] = info
+			if rr.unchanged(file, prev, info, offset) {
+				return nil
+			}
+		}
+	}
+	if open {
 		return nil
 	}
+	rr.opens.Acquire()
 	fd, err := rr.fs.Open(file)
 	if err != nil {
+		rr.opens.Release()
+		return err
+	}
+	size, err := fd.Seek(0, io.SeekEnd)
+	// The slot only covers opening the file. Detecting compression and
+	// skipping already-read data may read a lot, so don't hold it for them.
+	rr.opens.Release()
+	if err != nil {
+		fd.Close()
 		return err
 	}
-	rr.fds[file] = fd
-	br := rr.newBufioReader(fd)
-	er := eventfile.ReaderBuilder{File: br}.Start()
+	if _, ok := rr.infos[file]; !ok {
+		// Until the file is next checked, its size is all there is to
+		// compare against.
+		rr.infos[file] = fs.FileInfo{Size: size}
+	}
+	comp, known := rr.compression[file]
+	if !known {
+		if comp, known, err = detectCompression(file, fd, size); err != nil {
+			fd.Close()
+			return err
+		}
+		if !known {
+			// Too short to tell yet, and too short to have any
+			// records: try again once it's grown.
+			rr.updateProgress(file, offset, size)
+			return fd.Close()
+		}
+		rr.compression[file] = comp
+	}
+
+	var r io.Reader
+	var closer io.Closer = fd
+	if comp == tbio.NoCompression {
+		if size < offset {
+			// Truncated while dormant, as when restored from a
+			// snapshot: start over.
+			rr.resetProgress(file)
+			eventFileRewrites.WithLabelValues(rr.logdir).Inc()
+			offset, dormant = 0, false
+		}
+		rr.updateProgress(file, offset, size)
+		if dormant && size == offset {
+			return fd.Close() // no new data yet
+		}
+		if _, err := fd.Seek(offset, io.SeekStart); err != nil {
+			fd.Close()
+			return err
+		}
+		r = countingReader{fd, eventFileBytesRead.WithLabelValues(rr.logdir)}
+	} else {
+		if dormant && statted && size == prev.Size {
+			rr.updateProgress(file, size, size)
+			return fd.Close() // no new data yet
+		}
+		z, skipped, err := rr.inflate(file, fd, comp, offset)
+		if err != nil {
+			fd.Close()
+			return err
+		}
+		offset = skipped
+		rr.updateProgress(file, z.BytesIn(), size)
+		r = z
+		closer = compressedFile{z, fd}
+	}
+	delete(rr.dormant, file)
+	eventFilesOpen.Add(1)
+	rr.fds[file] = closer
+	rr.offsets[file] = offset
+	// Check it on the next reload regardless, to fill in the rest of its
+	// description.
+	rr.checked[file] = -1
+	rr.lastRead[file] = time.Now()
+	br := rr.newBufioReader(r)
+	er := eventfile.ReaderBuilder{File: br, Offset: offset, Recover: rr.recover}.Start()
 	rr.loaders[file] = er
 	return nil
 }
 
-func (rr *Reader) readfrom(file string) {
+// detectCompression reads the start of an open event file of the given size
+// to detect its compression, as with tbio.DetectCompression. It leaves the
+// file at an unspecified position.
+func detectCompression(file string, fd fs.File, size int64) (tbio.Compression, bool, error) {
+	n := int64(tbio.DetectPrefixLength)
+	if size < n {
+		n = size
+	}
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return 0, false, err
+	}
+	prefix := make([]byte, n)
+	read, err := io.ReadFull(fd, prefix)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, false, err
+	}
+	c, ok := tbio.DetectCompression(file, prefix[:read])
+	return c, ok, nil
+}
+
+// inflate starts decompressing a compressed event file from the start, since
+// decompression can't resume partway through, and discards the given number
+// of decompressed bytes that have already been read. If the file has fewer
+// decompressed bytes than that, it must have been rewritten while dormant (as
+// when restored from a snapshot), so inflate starts over and discards none. It
+// returns the number of bytes discarded.
+//
+// So each time a compressed file is reopened, as when it's been dormant or the
+// server has restarted, everything read from it so far is read and
+// decompressed again, which for a large file can take a while. Bytes re-read
+// this way aren't counted in eventFileBytesRead.
+func (rr *Reader) inflate(file string, fd fs.File, comp tbio.Compression, offset int64) (*tbio.Inflater, int64, error) {
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	cr := &lateCountingReader{countingReader: countingReader{fd, eventFileBytesRead.WithLabelValues(rr.logdir)}}
+	z := tbio.NewInflater(comp, cr)
+	if offset == 0 {
+		cr.start()
+		return z, 0, nil
+	}
+	_, err := io.CopyN(ioutil.Discard, z, offset)
+	if err == nil {
+		cr.start()
+		return z, offset, nil
+	}
+	z.Close()
+	if err != io.EOF {
+		return nil, 0, err
+	}
+	rr.resetProgress(file)
+	eventFileRewrites.WithLabelValues(rr.logdir).Inc()
+	return rr.inflate(file, fd, comp, 0)
+}
+
+// A compressedFile is an open compressed event file, read through an
+// Inflater.
+type compressedFile struct {
+	*tbio.Inflater
+	fd fs.File
+}
+
+// Close closes both the Inflater and the underlying file.
+func (f compressedFile) Close() error {
+	f.Inflater.Close()
+	return f.fd.Close()
+}
+
+// stat stats an event file, holding a slot from rr.opens as for an open, since
+// it's a request to the filesystem all the same.
+func (rr *Reader) stat(file string) (fs.FileInfo, error) {
+	rr.opens.Acquire()
+	defer rr.opens.Release()
+	return rr.fs.Stat(file)
+}
+
+// rewritten tests whether an event file read up to the given offset has been
+// truncated or replaced, given its descriptions as of the last check and now.
+// A rewritten file is one that's now smaller than the offset read so far,
+// that's a different file by fs.FileInfo.SameFile, or whose modification time
+// has gone backward.
+func (rr *Reader) rewritten(file string, prev, info fs.FileInfo, offset int64) bool {
+	shrunk := info.Size < offset
+	if rr.compression[file] != tbio.NoCompression {
+		// Offsets are into the decompressed data, so compare sizes
+		// instead.
+		shrunk = info.Size < prev.Size
+	}
+	return shrunk || !prev.SameFile(info) || info.ModTime.Before(prev.ModTime)
+}
+
+// unchanged tests whether a dormant event file read up to the given offset has
+// no new data, given its descriptions as of the last check and now, updating
+// its progress if so. Then it needn't be reopened.
+func (rr *Reader) unchanged(file string, prev, info fs.FileInfo, offset int64) bool {
+	comp, known := rr.compression[file]
+	switch {
+	case !known:
+		return false
+	case comp == tbio.NoCompression && info.Size == offset:
+		rr.updateProgress(file, offset, info.Size)
+		return true
+	case comp != tbio.NoCompression && info.Size == prev.Size:
+		rr.updateProgress(file, info.Size, info.Size)
+		return true
+	}
+	return false
+}
+
+// forget discards all state for an event file, aborting its loader (which must
+// be asleep or dead) and closing it if it's open, so that it's next read from
+// the start. The reservoirs will preempt old data as the steps repeat.
+func (rr *Reader) forget(file string) {
+	if efr := rr.loaders[file]; efr != nil {
+		efr.Wake <- eventfile.Abort
+	}
+	if fd, ok := rr.fds[file]; ok {
+		eventFilesOpen.Add(-1)
+		if err := fd.Close(); err != nil {
+			rr.out <- ValueResult{Err: newLoadError(file, -1, LoadErrorIO, err)}
+		}
+	}
+	delete(rr.loaders, file)
+	delete(rr.fds, file)
+	delete(rr.offsets, file)
+	delete(rr.lastRead, file)
+	delete(rr.checked, file)
+	delete(rr.dormant, file)
+	delete(rr.infos, file)
+	delete(rr.compression, file)
+	rr.resetProgress(file)
+}
+
+// closeInactive closes each event file that should be closed under the
+// reader's inactivity policy, given the names of all event files in the run
+// directory in lexical order. The file's loader must be asleep. It also closes
+// files whose loaders have died, which are never read again unless rewritten.
+// It sends zero or more error results along rr.out.
+func (rr *Reader) closeInactive(files []string) {
+	var newest string
+	if len(files) > 0 {
+		newest = files[len(files)-1]
+	}
+	now := time.Now()
+	for file, efr := range rr.loaders {
+		if efr == nil {
+			// Loader already aborted. Keep its nil entry so that
+			// the file isn't reopened.
+			if fd, ok := rr.fds[file]; ok {
+				eventFilesOpen.Add(-1)
+				if err := fd.Close(); err != nil {
+					rr.out <- ValueResult{Err: newLoadError(file, -1, LoadErrorIO, err)}
+				}
+				delete(rr.fds, file)
+				delete(rr.lastRead, file)
+			}
+			continue
+		}
+		superseded := rr.closeSuperseded && file < newest
+		inactive := rr.inactiveAge > 0 && now.Sub(rr.lastRead[file]) >= rr.inactiveAge
+		if !superseded && !inactive {
+			continue
+		}
+		efr.Wake <- eventfile.Abort
+		eventFilesOpen.Add(-1)
+		if err := rr.fds[file].Close(); err != nil {
+			rr.out <- ValueResult{Err: newLoadError(file, -1, LoadErrorIO, err)}
+		}
+		rr.dormant[file] = rr.offsets[file]
+		delete(rr.loaders, file)
+		delete(rr.fds, file)
+		delete(rr.offsets, file)
+		delete(rr.lastRead, file)
+		delete(rr.checked, file)
+	}
+}
+
+// readfrom reads from the given file until its loader goes to sleep or dies,
+// returning true, or until the budget (if not nil) runs out, returning false.
+// Each record read decrements the budget. If it returns false, the loader is
+// left awake, and the next call picks up where this one left off.
+func (rr *Reader) readfrom(file string, budget *int) bool {
 	efr := rr.loaders[file]
 	if efr == nil {
-		return // loader already aborted
+		return true // loader already aborted
+	}
+	if !rr.awake {
+		efr.Wake <- eventfile.Resume
+		rr.awake = true
 	}
-	efr.Wake <- eventfile.Resume
 	for {
+		if budget != nil && *budget <= 0 {
+			return false
+		}
 		select {
 		case <-efr.Asleep:
-			return
+			rr.awake = false
+			return true
 		case res := <-efr.Results:
+			if budget != nil {
+				*budget--
+			}
+			if !res.Fatal {
+				eventFileRecordsRead.WithLabelValues(rr.logdir).Inc()
+			}
+			if res.Err != nil {
+				kind := errorKind(res)
+				eventFileErrors.WithLabelValues(rr.logdir, kind.String()).Inc()
+				rr.out <- ValueResult{Err: newLoadError(file, res.Offset, kind, res.Err)}
+			}
 			if res.Fatal {
+				// The event file reader has exited and will never
+				// go to sleep, so stop waiting on it. Defer closing
+				// rr.fds[file] until the end of the reload.
 				rr.loaders[file] = nil
-				rr.out <- ValueResult{Err: res.Err}
-				// Defer closing rr.fds[file] until rr.Close().
-				break
+				rr.awake = false
+				return true
 			}
+			rr.offsets[file] = res.NextOffset
+			if f, ok := rr.fds[file].(compressedFile); ok {
+				rr.updateProgress(file, f.BytesIn(), 0)
+			} else {
+				rr.updateProgress(file, res.NextOffset, 0)
+			}
+			rr.lastRead[file] = time.Now()
 			if res.Err != nil {
-				rr.out <- ValueResult{Err: res.Err}
 				continue
 			}
 			rr.sendValues(res.Event)
@@ -193,8 +694,117 @@ func (rr *Reader) readfrom(file string) {
 	}
 }
 
+// resetProgress discards the progress for a file, as when it's been rewritten.
+func (rr *Reader) resetProgress(file string) {
+	rr.progressMu.Lock()
+	defer rr.progressMu.Unlock()
+	delete(rr.progress, file)
+}
+
+// updateProgress records that a file has been read up to the given offset and
+// has at least the given size.
+func (rr *Reader) updateProgress(file string, read int64, size int64) {
+	rr.progressMu.Lock()
+	defer rr.progressMu.Unlock()
+	p := rr.progress[file]
+	p.read = read
+	if size > p.size {
+		p.size = size
+	}
+	if read > p.size {
+		p.size = read
+	}
+	rr.progress[file] = p
+}
+
+// Progress returns how much of the run's event files has been read. Unlike
+// other methods, it may be called concurrently with anything, including Reload.
+func (rr *Reader) Progress() Progress {
+	rr.progressMu.Lock()
+	defer rr.progressMu.Unlock()
+	result := Progress{Files: len(rr.progress)}
+	for _, p := range rr.progress {
+		result.BytesRead += p.read
+		result.TotalBytes += p.size
+	}
+	return result
+}
+
+// checkpoint records the current offsets of all event files, whether open or
+// dormant, and the current metadata.
+func (rr *Reader) checkpoint() *Checkpoint {
+	cp := &Checkpoint{
+		Offsets:  make(map[string]int64, len(rr.offsets)+len(rr.dormant)),
+		Metadata: make(mem.MetadataStore, len(rr.mds)),
+	}
+	for file, offset := range rr.offsets {
+		cp.Offsets[file] = offset
+	}
+	for file, offset := range rr.dormant {
+		cp.Offsets[file] = offset
+	}
+	for tag, md := range rr.mds {
+		cp.Metadata[tag] = md
+	}
+	return cp
+}
+
+// errorKind classifies a failed event result.
+func errorKind(res eventfile.EventResult) LoadErrorKind {
+	switch {
+	case res.Fatal:
+		return LoadErrorFatal
+	case status.Code(res.Err) == codes.DataLoss:
+		return LoadErrorDataLoss
+	default:
+		return LoadErrorParse
+	}
+}
+
+// countingReader wraps an io.Reader to count the bytes read from it.
+type countingReader struct {
+	r io.Reader
+	c prometheus.Counter
+}
+
+func (cr countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.c.Add(float64(n))
+	return n, err
+}
+
+// lateCountingReader is a countingReader that doesn't count until start is
+// called, which may be concurrent with Read. Bytes read ahead of the caller
+// before then also go uncounted.
+type lateCountingReader struct {
+	countingReader
+	// counting is set to 1 by start; use atomic operations.
+	counting int32
+}
+
+func (cr *lateCountingReader) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&cr.counting) == 0 {
+		return cr.r.Read(p)
+	}
+	return cr.countingReader.Read(p)
+}
+
+// start starts counting bytes read.
+func (cr *lateCountingReader) start() {
+	atomic.StoreInt32(&cr.counting, 1)
+}
+
 func (rr *Reader) sendValues(ev *epb.Event) {
-	for _, v := range mem.EventValues(ev, rr.mds) {
+	values := mem.EventValues(ev, rr.mds)
+	if len(values) == 0 {
+		datum := &ValueDatum{
+			EventStep:     mem.Step(ev.Step),
+			EventWallTime: ev.WallTime,
+		}
+		rr.out <- ValueResult{Datum: datum}
+		return
+	}
+	for _, v := range values {
 		datum := &ValueDatum{
 			EventStep:     mem.Step(ev.Step),
 			EventWallTime: ev.WallTime,
@@ -204,13 +814,34 @@ func (rr *Reader) sendValues(ev *epb.Event) {
 	}
 }
 
-// Close implements io.Closer. If there are multiple errors when closing
-// underlying files, an arbitrary one is returned.
+// Close implements io.Closer. It stops the loading goroutine and closes the
+// Out channel. If there are multiple errors when closing underlying files, an
+// arbitrary one is returned. Must not be called concurrently with any other
+// method on the reader, and the reader must not be used after it is closed.
 func (rr *Reader) Close() error {
-	for _, efr := range rr.loaders {
+	close(rr.reload)
+	for file, efr := range rr.loaders {
 		if efr == nil {
 			continue
 		}
+		if rr.awake && file == rr.pending[0] {
+			// Partway through the file: drain it until it goes to
+			// sleep or dies.
+			go func(efr *eventfile.Reader) {
+				for {
+					select {
+					case res := <-efr.Results:
+						if res.Fatal {
+							return
+						}
+					case <-efr.Asleep:
+						efr.Wake <- eventfile.Abort
+						return
+					}
+				}
+			}(efr)
+			continue
+		}
 		go func(efr *eventfile.Reader) {
 			efr.Wake <- eventfile.Abort
 		}(efr)
@@ -221,6 +852,7 @@ func (rr *Reader) Close() error {
 		if f == nil {
 			continue
 		}
+		eventFilesOpen.Add(-1)
 		err := f.Close()
 		if firstErr == nil {
 			firstErr = err
@@ -233,10 +865,28 @@ func (rr *Reader) Close() error {
 // until the reload finishes. Must not be called concurrently with any method
 // on the reader, including another call to Reload.
 func (rr *Reader) Reload() {
-	rr.reload <- struct{}{}
+	rr.reload <- 0
 	<-rr.asleep
 }
 
+// ReloadSome is like Reload, but stops early after reading maxRecords records,
+// if maxRecords is positive. It returns true if the reload finished. If it
+// returns false, the next call to ReloadSome or Reload continues the same
+// reload, so that calling ReloadSome until it returns true is equivalent to
+// calling Reload, but lets the caller interleave work on other readers. Has the
+// same concurrency restrictions as Reload.
+func (rr *Reader) ReloadSome(maxRecords int) bool {
+	rr.reload <- maxRecords
+	return <-rr.asleep
+}
+
+// Checkpoint sends a Checkpoint of how far the reader has read, even in the
+// middle of a reload, so that a run whose reload is abandoned can still be
+// snapshotted. Has the same concurrency restrictions as Reload.
+func (rr *Reader) Checkpoint() {
+	rr.out <- ValueResult{Checkpoint: rr.checkpoint()}
+}
+
 // MetadataStore returns the mem.MetadataStore tracked by this reader, which
 // must not be accessed concurrent with any Reload.
 func (rr *Reader) MetadataStore() mem.MetadataStore {
@@ -0,0 +1,720 @@
+package run
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	epb "github.com/tensorflow/tensorflow/tensorflow/go/core/util/event_go_proto"
+	"github.com/wchargin/tensorboard-data-server/fs"
+	tbio "github.com/wchargin/tensorboard-data-server/io"
+)
+
+// reloadAll calls rr.Reload and collects all results sent during the reload,
+// except for the final checkpoint.
+func reloadAll(t *testing.T, rr *Reader) []ValueResult {
+	results, _ := reloadCheckpoint(t, rr)
+	return results
+}
+
+// reloadCheckpoint calls rr.Reload and collects all results sent during the
+// reload, which must end with a checkpoint, and returns the results before the
+// checkpoint along with the checkpoint itself.
+func reloadCheckpoint(t *testing.T, rr *Reader) ([]ValueResult, *Checkpoint) {
+	results, _ := reloadSome(t, rr, 0)
+	if len(results) == 0 || results[len(results)-1].Checkpoint == nil {
+		t.Fatalf("Reload: got results %v, want final checkpoint", results)
+	}
+	last := len(results) - 1
+	return results[:last], results[last].Checkpoint
+}
+
+// reloadSome calls rr.ReloadSome(maxRecords) and collects all results sent
+// during the call, including any checkpoint, along with whether the reload
+// finished.
+func reloadSome(t *testing.T, rr *Reader, maxRecords int) ([]ValueResult, bool) {
+	done := make(chan bool)
+	go func() {
+		done <- rr.ReloadSome(maxRecords)
+	}()
+	var results []ValueResult
+	for {
+		select {
+		case res := <-rr.Out:
+			results = append(results, res)
+		case finished := <-done:
+			return results, finished
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Reload: no interaction after 5s; got %v results so far", len(results))
+		}
+	}
+}
+
+func TestReaderLoadErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	event, err := proto.Marshal(&epb.Event{
+		WallTime: 1234.5,
+		What:     &epb.Event_FileVersion{FileVersion: "brain.Event:2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := tbio.NewTFRecord(event)
+	size := int64(record.ByteSize())
+
+	var buf bytes.Buffer
+	record.Write(&buf)
+	// Corrupt the data of the second record, which is skipped.
+	record.Write(&buf)
+	buf.Bytes()[2*size-1] ^= 0x55
+	record.Write(&buf)
+	// Write an all-zeros record, whose length checksum is wrong.
+	emptyRecord := tbio.NewTFRecord(nil)
+	buf.Write(make([]byte, emptyRecord.ByteSize()))
+	record.Write(&buf)
+
+	file := filepath.Join(dir, "events.out.tfevents.123.myhost")
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := ReaderBuilder{FS: fs.OS{}, Dir: dir}.Start()
+	defer rr.Close()
+
+	results := reloadAll(t, rr)
+	var errs []*LoadError
+	var data int
+	for _, res := range results {
+		if res.Err != nil {
+			errs = append(errs, res.Err.(*LoadError))
+		} else {
+			data++
+		}
+	}
+	if got, want := data, 2; got != want {
+		t.Errorf("number of data: got %v, want %v", got, want)
+	}
+	wantErrs := []LoadError{
+		{File: file, Offset: size, Kind: LoadErrorDataLoss},
+		{File: file, Offset: 3 * size, Kind: LoadErrorFatal},
+	}
+	if len(errs) != len(wantErrs) {
+		t.Fatalf("errors: got %v, want %v", errs, wantErrs)
+	}
+	for i, want := range wantErrs {
+		got := errs[i]
+		if got.File != want.File || got.Offset != want.Offset || got.Kind != want.Kind || got.Err == nil || got.Time.IsZero() {
+			t.Errorf("errs[%v]: got %+v, want %+v", i, got, want)
+		}
+	}
+
+	// The file is dead, so reloading again should yield nothing.
+	if results := reloadAll(t, rr); len(results) != 0 {
+		t.Errorf("second reload: got %v, want no results", results)
+	}
+	// Reading stopped at the fatal error, short of the end of the file.
+	want := Progress{Files: 1, BytesRead: 3 * size, TotalBytes: int64(buf.Len())}
+	if got := rr.Progress(); got != want {
+		t.Errorf("Progress(): got %+v, want %+v", got, want)
+	}
+}
+
+func TestReaderListError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(dir)
+
+	rr := ReaderBuilder{FS: fs.OS{}, Dir: dir}.Start()
+	defer rr.Close()
+
+	results := reloadAll(t, rr)
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("results: got %v, want one error", results)
+	}
+	le := results[0].Err.(*LoadError)
+	if le.File != dir || le.Offset != -1 || le.Kind != LoadErrorIO || !os.IsNotExist(le.Err) {
+		t.Errorf("error: got %+v, want IO error for %q", le, dir)
+	}
+}
+
+func TestReaderClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rr := ReaderBuilder{FS: fs.OS{}, Dir: dir}.Start()
+	reloadAll(t, rr)
+	if err := rr.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	select {
+	case res, ok := <-rr.Out:
+		if ok {
+			t.Errorf("after Close: got result %+v, want closed channel", res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("after Close: Out not closed after 5s")
+	}
+}
+
+// stepRecord returns a serialized record of an event with the given step.
+func stepRecord(t *testing.T, step int64) []byte {
+	data, err := proto.Marshal(&epb.Event{Step: step, WallTime: 1234.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := tbio.NewTFRecord(data)
+	var buf bytes.Buffer
+	record.Write(&buf)
+	return buf.Bytes()
+}
+
+// appendBytes appends each buffer to the given file, creating it if needed.
+func appendBytes(t *testing.T, file string, bufs ...[]byte) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, buf := range bufs {
+		if _, err := f.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reloadSteps reloads rr and returns the steps of all data read, failing the
+// test on any error.
+func reloadSteps(t *testing.T, rr *Reader) []int64 {
+	var steps []int64
+	for _, res := range reloadAll(t, rr) {
+		if res.Err != nil {
+			t.Fatalf("Reload: unexpected error: %v", res.Err)
+		}
+		steps = append(steps, int64(res.Datum.EventStep))
+	}
+	return steps
+}
+
+func checkSteps(t *testing.T, desc string, got []int64, want ...int64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: got steps %v, want %v", desc, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s: got steps %v, want %v", desc, got, want)
+			return
+		}
+	}
+}
+
+func TestReaderCloseSuperseded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	older := filepath.Join(dir, "events.out.tfevents.0000000001.myhost")
+	newer := filepath.Join(dir, "events.out.tfevents.0000000002.myhost")
+
+	rr := ReaderBuilder{FS: fs.OS{}, Dir: dir, CloseSuperseded: true}.Start()
+	defer rr.Close()
+
+	appendBytes(t, older, stepRecord(t, 0), stepRecord(t, 1))
+	checkSteps(t, "first reload", reloadSteps(t, rr), 0, 1)
+	if _, ok := rr.fds[older]; !ok {
+		t.Errorf("after first reload: older file closed, want open while newest")
+	}
+
+	appendBytes(t, newer, stepRecord(t, 10))
+	checkSteps(t, "second reload", reloadSteps(t, rr), 10)
+	if _, ok := rr.fds[older]; ok {
+		t.Errorf("after second reload: older file open, want closed once superseded")
+	}
+	if _, ok := rr.fds[newer]; !ok {
+		t.Errorf("after second reload: newer file closed, want open")
+	}
+
+	// Growing the older file, even by a partial record, should reopen it
+	// from where it left off.
+	partial := stepRecord(t, 3)
+	appendBytes(t, older, stepRecord(t, 2), partial[:5])
+	checkSteps(t, "third reload", reloadSteps(t, rr), 2)
+	if _, ok := rr.fds[older]; ok {
+		t.Errorf("after third reload: older file open, want closed again")
+	}
+	appendBytes(t, older, partial[5:])
+	checkSteps(t, "fourth reload", reloadSteps(t, rr), 3)
+	checkSteps(t, "fifth reload", reloadSteps(t, rr))
+}
+
+func TestReaderRewrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "events.out.tfevents.0000000001.myhost")
+
+	rr := ReaderBuilder{FS: fs.OS{}, Dir: dir}.Start()
+	defer rr.Close()
+
+	appendBytes(t, file, stepRecord(t, 0), stepRecord(t, 1), stepRecord(t, 2))
+	checkSteps(t, "first reload", reloadSteps(t, rr), 0, 1, 2)
+
+	// Truncating the file in place and writing less than before should
+	// start over from the beginning.
+	if err := os.Truncate(file, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendBytes(t, file, stepRecord(t, 0))
+	checkSteps(t, "after truncation", reloadSteps(t, rr), 0)
+
+	// Replacing the file with a bigger one should also start over, even
+	// though the reader still has the old file open.
+	tmp := filepath.Join(dir, "tmp")
+	appendBytes(t, tmp, stepRecord(t, 0), stepRecord(t, 1), stepRecord(t, 2), stepRecord(t, 3))
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	checkSteps(t, "after replacement", reloadSteps(t, rr), 0, 1, 2, 3)
+
+	appendBytes(t, file, stepRecord(t, 4))
+	checkSteps(t, "after append", reloadSteps(t, rr), 4)
+	var size int
+	for step := int64(0); step < 5; step++ {
+		size += len(stepRecord(t, step))
+	}
+	if got, want := rr.Progress().BytesRead, int64(size); got != want {
+		t.Errorf("Progress().BytesRead: got %v, want %v", got, want)
+	}
+}
+
+func TestReaderRewriteDormant(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "events.out.tfevents.0000000001.myhost")
+	appendBytes(t, file, stepRecord(t, 0), stepRecord(t, 1))
+
+	// A file that's shorter than its resume offset, as from a snapshot
+	// taken before the file was rewritten, should be read from the start.
+	rr := ReaderBuilder{FS: fs.OS{}, Dir: dir}.newReader()
+	rr.dormant[file] = 1000
+	go rr.start()
+	defer rr.Close()
+	checkSteps(t, "first reload", reloadSteps(t, rr), 0, 1)
+	checkSteps(t, "second reload", reloadSteps(t, rr))
+}
+
+func TestReaderInactiveAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "events.out.tfevents.0000000001.myhost")
+
+	rr := ReaderBuilder{FS: fs.OS{}, Dir: dir, InactiveAge: time.Nanosecond}.Start()
+	defer rr.Close()
+
+	appendBytes(t, file, stepRecord(t, 0))
+	checkSteps(t, "first reload", reloadSteps(t, rr), 0)
+	if len(rr.fds) != 0 {
+		t.Errorf("after first reload: got open files %v, want none", rr.fds)
+	}
+	checkSteps(t, "second reload", reloadSteps(t, rr))
+
+	// Errors after reopening should report offsets from the start of the
+	// file.
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := stepRecord(t, 1)
+	bad[len(bad)-1] ^= 0x55
+	appendBytes(t, file, bad, stepRecord(t, 2))
+	results := reloadAll(t, rr)
+	if len(results) != 2 || results[0].Err == nil || results[1].Err != nil {
+		t.Fatalf("third reload: got %v, want one error and one datum", results)
+	}
+	if got, want := results[0].Err.(*LoadError).Offset, info.Size(); got != want {
+		t.Errorf("third reload: error offset: got %v, want %v", got, want)
+	}
+	if got, want := int64(results[1].Datum.EventStep), int64(2); got != want {
+		t.Errorf("third reload: step: got %v, want %v", got, want)
+	}
+}
+
+func TestReaderCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	older := filepath.Join(dir, "events.out.tfevents.0000000001.myhost")
+	newer := filepath.Join(dir, "events.out.tfevents.0000000002.myhost")
+
+	rr := ReaderBuilder{FS: fs.OS{}, Dir: dir, CloseSuperseded: true}.Start()
+	defer rr.Close()
+
+	record := stepRecord(t, 0)
+	size := int64(len(record))
+	appendBytes(t, older, record, record)
+	appendBytes(t, newer, record, record[:5])
+	_, cp := reloadCheckpoint(t, rr)
+	// Offsets should cover both open and dormant files, and exclude
+	// partial records.
+	if got, want := len(cp.Offsets), 2; got != want {
+		t.Errorf("offsets: got %v, want %v files", cp.Offsets, want)
+	}
+	if got, want := cp.Offsets[older], 2*size; got != want {
+		t.Errorf("offsets[older]: got %v, want %v", got, want)
+	}
+	if got, want := cp.Offsets[newer], size; got != want {
+		t.Errorf("offsets[newer]: got %v, want %v", got, want)
+	}
+}
+
+func TestReaderReloadSome(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i, name := range []string{"events.out.tfevents.1.myhost", "events.out.tfevents.2.myhost"} {
+		var records [][]byte
+		for j := 0; j < 4; j++ {
+			records = append(records, stepRecord(t, int64(10*i+j)))
+		}
+		appendBytes(t, filepath.Join(dir, name), records...)
+	}
+
+	rr := ReaderBuilder{FS: fs.OS{}, Dir: dir}.Start()
+
+	// Turns of 3 records should cross file boundaries and resume
+	// partway through files.
+	var steps []int64
+	for turn := 0; ; turn++ {
+		results, finished := reloadSome(t, rr, 3)
+		for _, res := range results {
+			if res.Datum != nil {
+				steps = append(steps, int64(res.Datum.EventStep))
+			}
+		}
+		hasCheckpoint := len(results) > 0 && results[len(results)-1].Checkpoint != nil
+		if hasCheckpoint != finished {
+			t.Errorf("turn %v: finished=%v, but got results %v", turn, finished, results)
+		}
+		if finished {
+			if turn != 2 {
+				t.Errorf("finished after %v turns, want 3", turn+1)
+			}
+			break
+		}
+		if turn > 2 {
+			t.Fatalf("not finished after %v turns", turn+1)
+		}
+	}
+	checkSteps(t, "turns", steps, 0, 1, 2, 3, 10, 11, 12, 13)
+
+	// Closing partway through a reload should not hang.
+	appendBytes(t, filepath.Join(dir, "events.out.tfevents.2.myhost"), stepRecord(t, 14), stepRecord(t, 15))
+	if _, finished := reloadSome(t, rr, 1); finished {
+		t.Errorf("partial reload: finished, want not")
+	}
+	if err := rr.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if _, ok := <-rr.Out; ok {
+		t.Errorf("Out: got value after Close, want closed")
+	}
+}
+
+func TestReaderMemShortReads(t *testing.T) {
+	mfs := &fs.Mem{}
+	file := "logs/train/events.out.tfevents.1.myhost"
+	mfs.Create(file)
+	if err := mfs.SetFaults(file, fs.MemFaults{MaxRead: 3}); err != nil {
+		t.Fatal(err)
+	}
+	rr := ReaderBuilder{FS: mfs, Dir: "logs/train"}.Start()
+	defer rr.Close()
+
+	// Records split across short reads and across reloads should be
+	// reassembled.
+	r0, r1, r2 := stepRecord(t, 0), stepRecord(t, 1), stepRecord(t, 2)
+	mfs.Append(file, r0)
+	mfs.Append(file, r1[:7])
+	checkSteps(t, "first reload", reloadSteps(t, rr), 0)
+	mfs.Append(file, r1[7:])
+	mfs.Append(file, r2)
+	checkSteps(t, "second reload", reloadSteps(t, rr), 1, 2)
+	checkSteps(t, "third reload", reloadSteps(t, rr))
+}
+
+func TestReaderMemReadFault(t *testing.T) {
+	mfs := &fs.Mem{}
+	file := "logs/train/events.out.tfevents.1.myhost"
+	record := stepRecord(t, 0)
+	size := int64(len(record))
+	mfs.Append(file, bytes.Repeat(record, 3))
+	// The first read detects compression, and each later read gets one
+	// record, so the third read fails just after the first record.
+	if err := mfs.SetFaults(file, fs.MemFaults{FailRead: 3, MaxRead: int(size)}); err != nil {
+		t.Fatal(err)
+	}
+	rr := ReaderBuilder{FS: mfs, Dir: "logs/train"}.Start()
+	defer rr.Close()
+
+	results := reloadAll(t, rr)
+	if len(results) != 2 || results[0].Err != nil || results[1].Err == nil {
+		t.Fatalf("first reload: got %v, want one datum and one error", results)
+	}
+	le := results[1].Err.(*LoadError)
+	if le.File != file || le.Offset != size || le.Kind != LoadErrorFatal || le.Err != fs.ErrInjectedFault {
+		t.Errorf("error: got %+v, want fatal injected fault at offset %v", le, size)
+	}
+	if _, ok := rr.fds[file]; ok {
+		t.Errorf("after first reload: dead file open, want closed")
+	}
+	// The file is dead, so reloading again should yield nothing, and
+	// shouldn't reopen it.
+	if results := reloadAll(t, rr); len(results) != 0 {
+		t.Errorf("second reload: got %v, want no results", results)
+	}
+	if _, ok := rr.fds[file]; ok {
+		t.Errorf("after second reload: dead file open, want closed")
+	}
+}
+
+func TestReaderMemRewrite(t *testing.T) {
+	mfs := &fs.Mem{}
+	file := "logs/train/events.out.tfevents.1.myhost"
+	rr := ReaderBuilder{FS: mfs, Dir: "logs/train"}.Start()
+	defer rr.Close()
+
+	mfs.Append(file, stepRecord(t, 0))
+	mfs.Append(file, stepRecord(t, 1))
+	checkSteps(t, "first reload", reloadSteps(t, rr), 0, 1)
+	// The file's identity is learned when it's first statted, on the
+	// reload after it's opened.
+	checkSteps(t, "second reload", reloadSteps(t, rr))
+
+	// Replacing the file with one of the same size should start over,
+	// since the new file has a different identity.
+	mfs.Create(file)
+	mfs.Append(file, stepRecord(t, 2))
+	mfs.Append(file, stepRecord(t, 3))
+	checkSteps(t, "after replacement", reloadSteps(t, rr), 2, 3)
+
+	// Deleting the only file removes the run directory, which should be
+	// reported but not be fatal to the reader.
+	if err := mfs.Delete(file); err != nil {
+		t.Fatal(err)
+	}
+	results := reloadAll(t, rr)
+	if len(results) != 1 || results[0].Err == nil || !os.IsNotExist(results[0].Err.(*LoadError).Err) {
+		t.Errorf("after deletion: got %v, want one ENOENT error", results)
+	}
+	mfs.Append(file, stepRecord(t, 4))
+	checkSteps(t, "after recreation", reloadSteps(t, rr), 4)
+}
+
+// statCounter is a Mem that counts calls to Stat.
+type statCounter struct {
+	*fs.Mem
+	stats int
+}
+
+func (sc *statCounter) Stat(p string) (fs.FileInfo, error) {
+	sc.stats++
+	return sc.Mem.Stat(p)
+}
+
+func TestReaderStats(t *testing.T) {
+	sc := &statCounter{Mem: &fs.Mem{}}
+	file := "logs/train/events.out.tfevents.1.myhost"
+	rr := ReaderBuilder{FS: sc, Dir: "logs/train"}.Start()
+	defer rr.Close()
+
+	// A new file is checked once on the reload after it's opened, then
+	// only once it's gone a reload without reading anything.
+	reloads := []struct {
+		desc  string
+		step  int64
+		grow  bool
+		stats int
+	}{
+		{"first reload", 0, true, 0},
+		{"second reload", 1, true, 1},
+		{"third reload", 2, true, 0},
+		{"fourth reload", 0, false, 0},
+		{"fifth reload", 0, false, 1},
+		{"sixth reload", 3, true, 1},
+		{"seventh reload", 0, false, 0},
+	}
+	for _, r := range reloads {
+		var want []int64
+		if r.grow {
+			sc.Append(file, stepRecord(t, r.step))
+			want = append(want, r.step)
+		}
+		sc.stats = 0
+		checkSteps(t, r.desc, reloadSteps(t, rr), want...)
+		if sc.stats != r.stats {
+			t.Errorf("%s: got %v stats, want %v", r.desc, sc.stats, r.stats)
+		}
+	}
+}
+
+// compressor is implemented by gzip and zlib writers.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func TestReaderCompressed(t *testing.T) {
+	cases := []struct {
+		desc string
+		base string
+		new  func(io.Writer) compressor
+	}{
+		{"gzip", "events.out.tfevents.1.myhost", func(w io.Writer) compressor { return gzip.NewWriter(w) }},
+		{"zlib", "events.out.tfevents.1.myhost", func(w io.Writer) compressor { return zlib.NewWriter(w) }},
+		{"gzip suffix", "events.out.tfevents.1.myhost.gz", func(w io.Writer) compressor { return gzip.NewWriter(w) }},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			mfs := &fs.Mem{}
+			file := "logs/train/" + c.base
+			rr := ReaderBuilder{FS: mfs, Dir: "logs/train"}.Start()
+			defer rr.Close()
+
+			// Buffer the compressed output so that it can be
+			// appended partway through a block.
+			var buf bytes.Buffer
+			w := c.new(&buf)
+			w.Write(stepRecord(t, 0))
+			w.Write(stepRecord(t, 1))
+			w.Flush()
+			flushed := buf.Len()
+			w.Write(stepRecord(t, 2))
+			w.Flush()
+			mfs.Append(file, buf.Next(flushed+2))
+			checkSteps(t, "first reload", reloadSteps(t, rr), 0, 1)
+			mfs.Append(file, buf.Next(buf.Len()))
+			checkSteps(t, "second reload", reloadSteps(t, rr), 2)
+			w.Write(stepRecord(t, 3))
+			w.Close()
+			mfs.Append(file, buf.Next(buf.Len()))
+			_, cp := reloadCheckpoint(t, rr)
+			var size int
+			for step := int64(0); step < 4; step++ {
+				size += len(stepRecord(t, step))
+			}
+			if got, want := cp.Offsets[file], int64(size); got != want {
+				t.Errorf("checkpoint offset: got %v, want %v decompressed bytes", got, want)
+			}
+			info, err := mfs.Stat(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := rr.Progress(), (Progress{Files: 1, BytesRead: info.Size, TotalBytes: info.Size}); got != want {
+				t.Errorf("Progress(): got %+v, want %+v in compressed bytes", got, want)
+			}
+		})
+	}
+}
+
+func TestReaderCompressedDormant(t *testing.T) {
+	mfs := &fs.Mem{}
+	file := "logs/train/events.out.tfevents.1.myhost"
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(stepRecord(t, 0))
+	w.Write(stepRecord(t, 1))
+	w.Flush()
+	mfs.Append(file, buf.Next(buf.Len()))
+
+	const logdir = "TestReaderCompressedDormant"
+	bytesRead := eventFileBytesRead.WithLabelValues(logdir)
+	rr := ReaderBuilder{FS: mfs, Dir: "logs/train", Logdir: logdir, InactiveAge: time.Nanosecond}.Start()
+	defer rr.Close()
+	checkSteps(t, "first reload", reloadSteps(t, rr), 0, 1)
+	if len(rr.fds) != 0 {
+		t.Errorf("after first reload: got open files %v, want none", rr.fds)
+	}
+	checkSteps(t, "second reload", reloadSteps(t, rr))
+
+	// Reopening should skip what's already been read, without counting
+	// it as read again.
+	before := testutil.ToFloat64(bytesRead)
+	w.Write(stepRecord(t, 2))
+	w.Flush()
+	grown := buf.Len()
+	mfs.Append(file, buf.Next(buf.Len()))
+	results, cp := reloadCheckpoint(t, rr)
+	if len(results) != 1 || results[0].Datum == nil || results[0].Datum.EventStep != 2 {
+		t.Errorf("third reload: got %v, want just step 2", results)
+	}
+	if got := testutil.ToFloat64(bytesRead) - before; got > float64(grown) {
+		t.Errorf("third reload: got %v bytes read, want at most the %v appended", got, grown)
+	}
+	checkSteps(t, "fourth reload", reloadSteps(t, rr))
+
+	// So should restoring from a checkpoint...
+	restored := ReaderBuilder{FS: mfs, Dir: "logs/train"}.newReader()
+	restored.dormant[file] = cp.Offsets[file] - int64(len(stepRecord(t, 2)))
+	go restored.start()
+	defer restored.Close()
+	checkSteps(t, "restored", reloadSteps(t, restored), 2)
+
+	// ...unless the file has fewer decompressed bytes than the offset, in
+	// which case it's read from the start.
+	truncated := ReaderBuilder{FS: mfs, Dir: "logs/train"}.newReader()
+	truncated.dormant[file] = 1000
+	go truncated.start()
+	defer truncated.Close()
+	checkSteps(t, "truncated", reloadSteps(t, truncated), 0, 1, 2)
+}
+
+func TestReaderCompressedCorrupt(t *testing.T) {
+	mfs := &fs.Mem{}
+	file := "logs/train/events.out.tfevents.1.myhost.gz"
+	mfs.Append(file, []byte("not actually gzip data"))
+	rr := ReaderBuilder{FS: mfs, Dir: "logs/train"}.Start()
+	defer rr.Close()
+
+	results := reloadAll(t, rr)
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("results: got %v, want one error", results)
+	}
+	if le := results[0].Err.(*LoadError); le.Offset != 0 || le.Kind != LoadErrorFatal {
+		t.Errorf("error: got %+v, want fatal error at offset 0", le)
+	}
+}
@@ -0,0 +1,28 @@
+package run
+
+// A Semaphore limits the number of concurrent operations, such as file opens
+// across many readers. A nil Semaphore imposes no limit.
+type Semaphore chan struct{}
+
+// NewSemaphore creates a Semaphore that admits up to n concurrent operations,
+// or returns nil if n is not positive.
+func NewSemaphore(n int) Semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(Semaphore, n)
+}
+
+// Acquire blocks until an operation may start.
+func (s Semaphore) Acquire() {
+	if s != nil {
+		s <- struct{}{}
+	}
+}
+
+// Release marks the end of an operation started with Acquire.
+func (s Semaphore) Release() {
+	if s != nil {
+		<-s
+	}
+}
@@ -0,0 +1,193 @@
+package run
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/wchargin/tensorboard-data-server/mem"
+	snpb "github.com/wchargin/tensorboard-data-server/proto/snapshot_proto"
+)
+
+// An accumulatorState is the state of an accumulator and its reader as of a
+// checkpoint, when the accumulator had ingested everything read so far.
+type accumulatorState struct {
+	checkpoint   *Checkpoint
+	mds          mem.MetadataStore
+	data         map[string]mem.ReservoirSnapshot
+	startTime    float64
+	hasStartTime bool
+}
+
+// ingestCheckpoint records the accumulator's current state along with the
+// reader's checkpoint. Reservoirs are only copied if data has been ingested
+// since the last checkpoint.
+func (acc *Accumulator) ingestCheckpoint(cp *Checkpoint) {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+	if acc.state != nil && !acc.dirty {
+		st := *acc.state
+		st.checkpoint = cp
+		acc.state = &st
+		return
+	}
+	st := &accumulatorState{
+		checkpoint:   cp,
+		mds:          make(mem.MetadataStore, len(acc.mds)),
+		data:         make(map[string]mem.ReservoirSnapshot, len(acc.data)),
+		startTime:    acc.startTime,
+		hasStartTime: acc.hasStartTime,
+	}
+	for tag, md := range acc.mds {
+		st.mds[tag] = md
+	}
+	for tag, rsv := range acc.data {
+		st.data[tag] = rsv.Snapshot()
+	}
+	acc.state = st
+	acc.dirty = false
+}
+
+// Snapshot returns the state of the accumulator and its reader as of the end of
+// the most recent reload, or nil if no reload has finished. The run name is
+// left empty for the caller to fill in.
+func (acc *Accumulator) Snapshot() *snpb.RunSnapshot {
+	acc.mu.Lock()
+	st := acc.state
+	acc.mu.Unlock()
+	if st == nil {
+		return nil
+	}
+
+	result := &snpb.RunSnapshot{
+		StartTime:    st.startTime,
+		HasStartTime: st.hasStartTime,
+	}
+	for _, file := range sortedFiles(st.checkpoint.Offsets) {
+		result.Files = append(result.Files, &snpb.FileOffset{Path: file, Offset: st.checkpoint.Offsets[file]})
+	}
+	for _, tag := range sortedTags(st.checkpoint.Metadata) {
+		result.ReaderMetadata = append(result.ReaderMetadata, &snpb.TagMetadata{Tag: tag, Metadata: st.checkpoint.Metadata[tag]})
+	}
+	for _, tag := range sortedTags(st.mds) {
+		ts := &snpb.TimeSeries{Tag: tag, Metadata: st.mds[tag]}
+		if rs, ok := st.data[tag]; ok {
+			ts.Reservoir = reservoirProto(rs)
+		}
+		result.TimeSeries = append(result.TimeSeries, ts)
+	}
+	return result
+}
+
+func sortedFiles(offsets map[string]int64) []string {
+	result := make([]string, 0, len(offsets))
+	for file := range offsets {
+		result = append(result, file)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func sortedTags(mds mem.MetadataStore) []string {
+	result := make([]string, 0, len(mds))
+	for tag := range mds {
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func reservoirProto(rs mem.ReservoirSnapshot) *snpb.Reservoir {
+	result := &snpb.Reservoir{
+		Capacity: rs.Capacity,
+		Seen:     int64(rs.Seen),
+		RngState: rs.RNGState,
+		Values:   make([]*snpb.Datum, len(rs.Values)),
+	}
+	for i, v := range rs.Values {
+		d := v.(ValueDatum)
+		result.Values[i] = &snpb.Datum{
+			Step:     int64(d.EventStep),
+			WallTime: d.EventWallTime,
+			Value:    d.Value,
+		}
+	}
+	return result
+}
+
+// RestoreSnapshot starts a reader and accumulator that resume from a snapshot
+// taken by Accumulator.Snapshot: the reader continues each event file from
+// where the snapshot left off, and the accumulator starts with the data read
+// before then. The reader starts dormant, as with ReaderBuilder.Start. The spp
+// argument is as for NewAccumulator. It's an error for the snapshot to have a
+// time series whose reservoir capacity differs from what spp would give it,
+// since such a time series can't be restored faithfully; on error, nothing is
+// started.
+func RestoreSnapshot(b ReaderBuilder, spp SamplesPerPlugin, snap *snpb.RunSnapshot) (*Reader, *Accumulator, error) {
+	cp := &Checkpoint{
+		Offsets:  make(map[string]int64, len(snap.Files)),
+		Metadata: make(mem.MetadataStore, len(snap.ReaderMetadata)),
+	}
+	for _, f := range snap.Files {
+		if f.Offset < 0 {
+			return nil, nil, fmt.Errorf("file %q: negative offset %v", f.Path, f.Offset)
+		}
+		cp.Offsets[f.Path] = f.Offset
+	}
+	for _, tm := range snap.ReaderMetadata {
+		cp.Metadata[tm.Tag] = tm.Metadata
+	}
+
+	mds := make(mem.MetadataStore, len(snap.TimeSeries))
+	data := make(map[string]mem.EagerReservoir)
+	for _, ts := range snap.TimeSeries {
+		mds[ts.Tag] = ts.Metadata
+		if ts.Reservoir == nil {
+			continue
+		}
+		if ts.Metadata == nil {
+			return nil, nil, fmt.Errorf("tag %q: data with no metadata", ts.Tag)
+		}
+		if got, want := ts.Reservoir.Capacity, spp.capacity(ts.Metadata); got != want {
+			return nil, nil, fmt.Errorf("tag %q: snapshot has capacity %v, but want %v", ts.Tag, got, want)
+		}
+		rsv, err := mem.RestoreEagerReservoir(reservoirSnapshot(ts.Reservoir))
+		if err != nil {
+			return nil, nil, fmt.Errorf("tag %q: %v", ts.Tag, err)
+		}
+		data[ts.Tag] = rsv
+	}
+
+	rr := b.newReader()
+	for file, offset := range cp.Offsets {
+		rr.dormant[file] = offset
+	}
+	for tag, md := range cp.Metadata {
+		rr.mds[tag] = md
+	}
+	acc := newAccumulator(rr, spp)
+	acc.mds = mds
+	acc.data = data
+	acc.startTime = snap.StartTime
+	acc.hasStartTime = snap.HasStartTime
+	acc.ingestCheckpoint(cp)
+	go rr.start()
+	go acc.start()
+	return rr, acc, nil
+}
+
+func reservoirSnapshot(r *snpb.Reservoir) mem.ReservoirSnapshot {
+	values := make([]mem.StepIndexed, len(r.Values))
+	for i, d := range r.Values {
+		values[i] = ValueDatum{
+			EventStep:     mem.Step(d.Step),
+			EventWallTime: d.WallTime,
+			Value:         d.Value,
+		}
+	}
+	return mem.ReservoirSnapshot{
+		Capacity: r.Capacity,
+		Seen:     int(r.Seen),
+		RNGState: r.RngState,
+		Values:   values,
+	}
+}
@@ -0,0 +1,162 @@
+package run
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	spb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/summary_go_proto"
+	epb "github.com/tensorflow/tensorflow/tensorflow/go/core/util/event_go_proto"
+	"github.com/wchargin/tensorboard-data-server/fs"
+	tbio "github.com/wchargin/tensorboard-data-server/io"
+	snpb "github.com/wchargin/tensorboard-data-server/proto/snapshot_proto"
+	"github.com/wchargin/tensorboard-data-server/summary"
+)
+
+// appendScalars appends events with "loss" scalars at the given steps.
+func appendScalars(t *testing.T, file string, steps ...int64) {
+	var buf bytes.Buffer
+	for _, step := range steps {
+		data, err := proto.Marshal(&epb.Event{
+			Step:     step,
+			WallTime: float64(1000 + step),
+			What: &epb.Event_Summary{Summary: &spb.Summary{
+				Value: []*spb.Summary_Value{summary.Scalar("loss", float64(step))},
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		record := tbio.NewTFRecord(data)
+		record.Write(&buf)
+	}
+	appendBytes(t, file, buf.Bytes())
+}
+
+// reloadSnapshot reloads rr and waits for acc to ingest the resulting
+// checkpoint, in which file's offset is its current size. It returns the
+// accumulator's snapshot.
+func reloadSnapshot(t *testing.T, rr *Reader, acc *Accumulator, file string) *snpb.RunSnapshot {
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr.Reload()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if snap := acc.Snapshot(); snap != nil {
+			for _, f := range snap.Files {
+				if f.Path == file && f.Offset == info.Size() {
+					return snap
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no snapshot at offset %v after 5s; last: %v", info.Size(), acc.Snapshot())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func sampleSteps(acc *Accumulator, tag string) []int64 {
+	var result []int64
+	for _, d := range acc.Sample(tag) {
+		result = append(result, int64(d.EventStep))
+	}
+	return result
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "events.out.tfevents.0000000001.myhost")
+	spp := SamplesPerPlugin{"scalars": 10}
+	var steps []int64
+	for step := int64(0); step < 50; step++ {
+		steps = append(steps, step)
+	}
+
+	rr1 := ReaderBuilder{FS: fs.OS{}, Dir: dir}.Start()
+	defer rr1.Close()
+	acc1 := NewAccumulator(rr1, spp)
+	if snap := acc1.Snapshot(); snap != nil {
+		t.Errorf("Snapshot before reload: got %v, want nil", snap)
+	}
+	appendScalars(t, file, steps[:30]...)
+	snap := reloadSnapshot(t, rr1, acc1, file)
+
+	// Round-trip through the wire format, as via a snapshot file.
+	buf, err := proto.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap = &snpb.RunSnapshot{}
+	if err := proto.Unmarshal(buf, snap); err != nil {
+		t.Fatal(err)
+	}
+
+	rr2, acc2, err := RestoreSnapshot(ReaderBuilder{FS: fs.OS{}, Dir: dir}, spp, snap)
+	if err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	defer rr2.Close()
+	if got, want := sampleSteps(acc2, "loss"), sampleSteps(acc1, "loss"); !int64sEqual(got, want) {
+		t.Errorf("restored sample: got %v, want %v", got, want)
+	}
+	if got, want := acc2.Snapshot(), snap; !proto.Equal(got, want) {
+		t.Errorf("restored snapshot: got %v, want %v", got, want)
+	}
+
+	// Both accumulators should sample new data identically, without the
+	// restored one re-reading old data.
+	appendScalars(t, file, steps[30:]...)
+	reloadSnapshot(t, rr1, acc1, file)
+	reloadSnapshot(t, rr2, acc2, file)
+	if got, want := sampleSteps(acc2, "loss"), sampleSteps(acc1, "loss"); !int64sEqual(got, want) {
+		t.Errorf("sample after more data: got %v, want %v", got, want)
+	}
+	if got, want := len(acc2.Sample("loss")), 10; got != want {
+		t.Errorf("sample size: got %v, want %v", got, want)
+	}
+	start, ok := acc2.StartTime()
+	if !ok || start != 1000 {
+		t.Errorf("StartTime: got %v, %v; want 1000, true", start, ok)
+	}
+}
+
+func TestRestoreSnapshotCapacityMismatch(t *testing.T) {
+	snap := &snpb.RunSnapshot{
+		TimeSeries: []*snpb.TimeSeries{
+			{
+				Tag:       "loss",
+				Metadata:  summary.Scalar("loss", 0).Metadata,
+				Reservoir: &snpb.Reservoir{Capacity: 10},
+			},
+		},
+	}
+	_, _, err := RestoreSnapshot(ReaderBuilder{FS: fs.OS{}, Dir: "unused"}, SamplesPerPlugin{"scalars": 20}, snap)
+	if err == nil || !strings.Contains(err.Error(), "capacity") {
+		t.Errorf("RestoreSnapshot: got %v, want capacity error", err)
+	}
+}
+
+func int64sEqual(xs, ys []int64) bool {
+	if len(xs) != len(ys) {
+		return false
+	}
+	for i := range xs {
+		if xs[i] != ys[i] {
+			return false
+		}
+	}
+	return true
+}
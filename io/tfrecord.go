@@ -157,6 +157,46 @@ func ReadRecord(statePtr **TFRecordState, r io.Reader) (*TFRecord, error) {
 	return &result, nil
 }
 
+// ScanRecordHeader recovers from a corrupt record header, after ReadRecord has
+// failed with an error other than io.EOF. It discards bytes from the start of
+// the header held in the state buffer, reading more from r as needed, until
+// the buffer holds a header whose length passes its checksum and is at most
+// maxLength. It returns the number of bytes discarded. On success, the next
+// call to ReadRecord with the same state buffer reads the rest of the record
+// after that header.
+//
+// If r runs out of data first, the second return value is io.EOF, and the
+// state buffer holds the bytes that may yet start a valid header. Call
+// ScanRecordHeader again with the same state buffer to continue scanning.
+// Reads are a byte at a time, so r should be buffered.
+func ScanRecordHeader(statePtr **TFRecordState, r io.Reader, maxLength uint64) (int64, error) {
+	if *statePtr == nil {
+		*statePtr = new(TFRecordState)
+	}
+	state := *statePtr
+	state.dataPlusFooter = nil
+	state.dataPlusFooterRead = 0
+
+	var skipped int64
+	for {
+		if state.headerRead == headerLength {
+			lengthBuf := state.header[:lengthCRCOffset]
+			lengthCRC := binary.LittleEndian.Uint32(state.header[lengthCRCOffset:])
+			length := binary.LittleEndian.Uint64(lengthBuf)
+			if computeMaskedCRC(lengthBuf) == lengthCRC && length <= maxLength {
+				state.dataPlusFooter = make([]byte, int(length)+footerLength)
+				return skipped, nil
+			}
+			copy(state.header[:], state.header[1:])
+			state.headerRead--
+			skipped++
+		}
+		if err := readRemaining(r, state.header[state.headerRead:], &state.headerRead); err != nil {
+			return skipped, err
+		}
+	}
+}
+
 func readRemaining(r io.Reader, buf []byte, readPtr *int) error {
 	n, err := io.ReadFull(r, buf)
 	*readPtr += n
@@ -160,6 +160,54 @@ func TestReadRecordDataCRCMismatch(t *testing.T) {
 	}
 }
 
+func TestScanRecordHeader(t *testing.T) {
+	var recBuf bytes.Buffer
+	rec := NewTFRecord([]byte("hello"))
+	rec.Write(&recBuf)
+	var bigBuf bytes.Buffer
+	big := NewTFRecord([]byte("a record longer than the limit"))
+	big.Write(&bigBuf)
+	bigHeader := bigBuf.String()[:headerLength]
+
+	// Garbage, then a header whose length exceeds the limit, then a good
+	// record, with EOFs partway through.
+	sr := scriptedReader([]*bytes.Buffer{
+		bytes.NewBufferString("\xff\xff\xff"),
+		bytes.NewBufferString("\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff" + bigHeader[:4]),
+		bytes.NewBufferString(bigHeader[4:] + recBuf.String()),
+	})
+	var st *TFRecordState
+	if _, err := ReadRecord(&st, &sr); err != io.EOF {
+		t.Fatalf("ReadRecord: got %v, want EOF", err)
+	}
+	rec2, err := ReadRecord(&st, &sr)
+	if rec2 != nil || status.Code(err) != codes.DataLoss {
+		t.Fatalf("ReadRecord: got %v, %v; want DataLoss", rec2, err)
+	}
+
+	var skipped int64
+	for i := 0; ; i++ {
+		n, err := ScanRecordHeader(&st, &sr, 10)
+		skipped += n
+		if err == nil {
+			break
+		}
+		if err != io.EOF || i > 1 {
+			t.Fatalf("ScanRecordHeader: got %v after skipping %v bytes, want success", err, skipped)
+		}
+	}
+	if want := int64(13 + headerLength); skipped != want {
+		t.Errorf("skipped: got %v, want %v", skipped, want)
+	}
+	got, err := ReadRecord(&st, &sr)
+	if err != nil {
+		t.Fatalf("ReadRecord after scan: %v", err)
+	}
+	if string(got.Data) != "hello" || got.Checksum() != nil {
+		t.Errorf("ReadRecord after scan: got %q (checksum %v), want %q", got.Data, got.Checksum(), "hello")
+	}
+}
+
 // grpcErrorLike checks whether err is a gRPC status with the provided code and
 // a message that contains the provided string as a substring.
 func grpcErrorLike(err error, wantCode codes.Code, wantMsgSubstr string) bool {
@@ -1,51 +1,332 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 
 	"github.com/wchargin/tensorboard-data-server/fs"
 	ioLogdir "github.com/wchargin/tensorboard-data-server/io/logdir"
+	"github.com/wchargin/tensorboard-data-server/io/run"
+	"github.com/wchargin/tensorboard-data-server/metrics"
 	dppb "github.com/wchargin/tensorboard-data-server/proto/data_provider_proto"
+	snpb "github.com/wchargin/tensorboard-data-server/proto/snapshot_proto"
 	"github.com/wchargin/tensorboard-data-server/server"
 )
 
-var logdir = flag.String("logdir", "", "log directory")
+var logdir = flag.String("logdir", "", "log directory: a local path, or a gs:// or s3:// URL; gs:// uses Google Application Default Credentials, and s3:// uses the AWS_* environment variables")
+var logdirSpec = flag.String("logdir_spec", "", `comma-separated "name:logdir" pairs, to serve each logdir as an experiment with the given ID; exclusive with --logdir`)
 var port = flag.Int("port", 6106, "server port")
+var metricsPort = flag.Int("metrics_port", 0, "port on which to serve Prometheus metrics at /metrics; 0 to disable")
 var reloadInterval = flag.Duration("reload_interval", 5*time.Second, "duration to wait between reloads")
+var samplesPerPlugin = flag.String("samples_per_plugin", "", `comma-separated "plugin=capacity" pairs, like "scalars=5000,images=0"; 0 keeps all points`)
+var inactiveFileAge = flag.Duration("inactive_file_age", 0, "close event files that have had no new records for this long, reopening them if they grow; 0 to keep them open")
+var closeSupersededFiles = flag.Bool("close_superseded_files", false, "close each event file once a newer event file exists in the same run, reopening it if it grows")
+var recoverCorruptRecords = flag.Bool("recover_corrupt_records", false, "on a corrupt record header, scan ahead for the next valid record instead of giving up on the rest of the event file")
+var snapshotDir = flag.String("snapshot_dir", "", "local directory in which to save snapshots of loaded data, to resume loading from on restart; empty to disable")
+var snapshotInterval = flag.Duration("snapshot_interval", 5*time.Minute, "minimum duration between snapshots of each logdir")
+var maxConcurrentReloads = flag.Int("max_concurrent_reloads", 0, "maximum number of runs to reload at once per logdir, taking turns so that large runs don't starve small ones; 0 for no limit")
+var maxConcurrentOpens = flag.Int("max_concurrent_opens", 0, "maximum number of event files in the middle of being opened or statted at once per logdir, to limit bursts of opens or storage requests; files already open don't count against it; 0 for no limit")
+var shutdownTimeout = flag.Duration("shutdown_timeout", 10*time.Second, "on SIGINT or SIGTERM, time to wait for in-flight RPCs and reloads to finish before exiting anyway")
+
+// dataProviderService is the full name of the data provider gRPC service, for
+// health checks.
+const dataProviderService = "tensorboard.data.TensorBoardDataProvider"
 
 func main() {
 	flag.Parse()
-	if len(*logdir) == 0 {
-		log.Fatalf("must specify log directory")
+	if (len(*logdir) == 0) == (len(*logdirSpec) == 0) {
+		log.Fatalf("must specify exactly one of --logdir and --logdir_spec")
 	}
 
-	ll := ioLogdir.LoaderBuilder{FS: fs.OS{}, Logdir: *logdir}.Start()
-	go func() {
-		ll.Reload()
-		log.Printf("logdir loaded; now polling")
-		for {
-			ll.Reload()
-			time.Sleep(*reloadInterval)
+	spp, err := run.ParseSamplesPerPlugin(*samplesPerPlugin)
+	if err != nil {
+		log.Fatalf("invalid --samples_per_plugin: %v", err)
+	}
+
+	// logdirs maps experiment IDs to log directories. With --logdir, the
+	// single log directory is keyed by the empty string.
+	logdirs := map[string]string{"": *logdir}
+	if len(*logdirSpec) != 0 {
+		if logdirs, err = ioLogdir.ParseSpec(*logdirSpec); err != nil {
+			log.Fatalf("invalid --logdir_spec: %v", err)
 		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lls := make(map[string]*ioLogdir.Loader)
+	var wg sync.WaitGroup
+	for eid, dir := range logdirs {
+		filesystem, path := logdirFilesystem(dir)
+		snapshot := ""
+		if *snapshotDir != "" {
+			snapshot = snapshotPath(*snapshotDir, dir)
+		}
+		ll := ioLogdir.LoaderBuilder{
+			FS:                    filesystem,
+			Logdir:                path,
+			SamplesPerPlugin:      spp,
+			InactiveAge:           *inactiveFileAge,
+			CloseSuperseded:       *closeSupersededFiles,
+			RecoverCorruptRecords: *recoverCorruptRecords,
+			Snapshot:              readSnapshot(snapshot),
+			MaxConcurrentReloads:  *maxConcurrentReloads,
+			MaxConcurrentOpens:    *maxConcurrentOpens,
+		}.Start()
+		lls[eid] = ll
+		wg.Add(1)
+		go func(dir string) {
+			defer wg.Done()
+			poll(ctx, ll, dir, *reloadInterval, snapshot)
+		}(dir)
+	}
+	polling := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(polling)
 	}()
 
+	var ms *http.Server
+	if *metricsPort != 0 {
+		ms = serveMetrics(lls, *metricsPort)
+	}
+
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 	log.Printf("listening on %s", lis.Addr())
 
-	s := grpc.NewServer()
-	dppb.RegisterTensorBoardDataProviderServer(s, server.NewServer(ll))
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(server.UnaryMetricsInterceptor),
+		grpc.StreamInterceptor(server.StreamMetricsInterceptor),
+	)
+	var dps *server.Server
+	if len(*logdirSpec) == 0 {
+		dps = server.NewServer(lls[""])
+	} else {
+		dps = server.NewMultiServer(lls)
+	}
+	dppb.RegisterTensorBoardDataProviderServer(s, dps)
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
 	reflection.Register(s)
-	if err := s.Serve(lis); err != nil {
+
+	// Report not serving until every logdir has finished its first load.
+	for _, svc := range []string{"", dataProviderService} {
+		hs.SetServingStatus(svc, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+	go func() {
+		for _, ll := range lls {
+			<-ll.Loaded()
+		}
+		for _, svc := range []string{"", dataProviderService} {
+			hs.SetServingStatus(svc, healthpb.HealthCheckResponse_SERVING)
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(lis)
+	}()
+	select {
+	case err := <-served:
 		log.Fatalf("failed to serve: %v", err)
+	case sig := <-sigs:
+		// Restore default handling so that a second signal kills the
+		// process immediately.
+		signal.Stop(sigs)
+		log.Printf("received %v; shutting down", sig)
+	}
+
+	timeout := time.After(*shutdownTimeout)
+	cancel()
+	hs.Shutdown()
+	dps.Shutdown()
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	if ms != nil {
+		go ms.Close()
+	}
+	for stopped != nil || polling != nil {
+		select {
+		case <-stopped:
+			stopped = nil
+		case <-polling:
+			polling = nil
+		case <-timeout:
+			log.Fatalf("shutdown did not finish after %v; exiting anyway", *shutdownTimeout)
+		}
+	}
+	for eid, ll := range lls {
+		if err := ll.Close(); err != nil {
+			log.Printf("closing log directory %q: %v", logdirs[eid], err)
+		}
+	}
+	log.Printf("shut down cleanly")
+}
+
+// poll reloads ll, then reloads it again every interval until ctx is canceled.
+// A reload in progress when ctx is canceled stops early. The dir argument
+// names the log directory for logging. If snapshot is not empty, poll also
+// writes a snapshot to that path after reloading if --snapshot_interval has
+// passed since the last one, and once more before returning.
+func poll(ctx context.Context, ll *ioLogdir.Loader, dir string, interval time.Duration, snapshot string) {
+	ll.Reload(ctx)
+	if ctx.Err() == nil {
+		log.Printf("logdir %q loaded; now polling", dir)
+	}
+	var lastSnapshot time.Time
+	for {
+		if ctx.Err() != nil {
+			if snapshot != "" {
+				writeSnapshot(ll, dir, snapshot)
+			}
+			return
+		}
+		if snapshot != "" && time.Since(lastSnapshot) >= *snapshotInterval {
+			writeSnapshot(ll, dir, snapshot)
+			lastSnapshot = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(interval):
+			ll.Reload(ctx)
+		}
+	}
+}
+
+// snapshotPath returns the path under snapshotDir at which to save snapshots of
+// the given log directory, named by a hash of the log directory.
+func snapshotPath(snapshotDir string, logdir string) string {
+	return filepath.Join(snapshotDir, fmt.Sprintf("%x.snapshot", sha256.Sum256([]byte(logdir))))
+}
+
+// readSnapshot reads a snapshot from the given path, returning nil if the path
+// is empty or the snapshot can't be read.
+func readSnapshot(path string) *snpb.LogdirSnapshot {
+	if path == "" {
+		return nil
+	}
+	snap, err := ioLogdir.ReadSnapshot(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("reading snapshot %q: %v; loading from scratch", path, err)
+		return nil
+	}
+	log.Printf("resuming from snapshot %q with %d runs", path, len(snap.Runs))
+	return snap
+}
+
+func writeSnapshot(ll *ioLogdir.Loader, dir string, path string) {
+	if err := ioLogdir.WriteSnapshot(path, ll.Snapshot()); err != nil {
+		log.Printf("writing snapshot of logdir %q: %v", dir, err)
+	}
+}
+
+// reservoirOccupancy describes the number of points stored for each time
+// series, computed afresh on each scrape.
+var reservoirOccupancy = prometheus.NewDesc(
+	prometheus.BuildFQName(metrics.Namespace, "", "reservoir_occupancy"),
+	"Number of points stored for a time series.",
+	[]string{"experiment", "run", "tag"}, nil,
+)
+
+// occupancyCollector is a prometheus.Collector that reports reservoir
+// occupancy for each time series in each loader, keyed by experiment ID.
+type occupancyCollector map[string]*ioLogdir.Loader
+
+func (c occupancyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- reservoirOccupancy
+}
+
+func (c occupancyCollector) Collect(ch chan<- prometheus.Metric) {
+	for eid, ll := range c {
+		for run, acc := range ll.Runs() {
+			for tag, n := range acc.Occupancy() {
+				ch <- prometheus.MustNewConstMetric(reservoirOccupancy, prometheus.GaugeValue, float64(n), eid, run, tag)
+			}
+		}
+	}
+}
+
+// serveMetrics starts an HTTP server in a new goroutine to serve metrics on the
+// given port, including reservoir occupancy for each time series in each
+// loader, keyed by experiment ID.
+func serveMetrics(lls map[string]*ioLogdir.Loader, port int) *http.Server {
+	metrics.Default.MustRegister(occupancyCollector(lls))
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Fatalf("failed to listen for metrics: %v", err)
+	}
+	log.Printf("serving metrics on %s", lis.Addr())
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	hs := &http.Server{Handler: mux}
+	go func() {
+		if err := hs.Serve(lis); err != http.ErrServerClosed {
+			log.Fatalf("failed to serve metrics: %v", err)
+		}
+	}()
+	return hs
+}
+
+// gcsScope is the OAuth scope requested for reading GCS logdirs.
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_only"
+
+// logdirFilesystem picks a filesystem based on the URL scheme of the given log
+// directory, and returns it along with the log directory as a path under that
+// filesystem. GCS requests use Application Default Credentials if there are
+// any, and are anonymous otherwise. S3 settings are read from the same
+// environment variables as in TensorFlow and the AWS CLI.
+func logdirFilesystem(logdir string) (fs.Filesystem, string) {
+	switch {
+	case strings.HasPrefix(logdir, "gs://"):
+		client, err := google.DefaultClient(context.Background(), gcsScope)
+		if err != nil {
+			log.Printf("no GCS credentials (%v); reading %s anonymously, so only public buckets will work", err, logdir)
+			client = nil
+		}
+		return fs.GCS{Client: client}, strings.TrimPrefix(logdir, "gs://")
+	case strings.HasPrefix(logdir, "s3://"):
+		s3 := fs.S3{
+			Endpoint: os.Getenv("S3_ENDPOINT"),
+			Region:   os.Getenv("AWS_REGION"),
+		}
+		if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+			s3.Credentials = &fs.S3Credentials{
+				AccessKeyID:     id,
+				SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			}
+		}
+		return s3, strings.TrimPrefix(logdir, "s3://")
+	default:
+		return fs.OS{}, logdir
 	}
 }
@@ -3,6 +3,8 @@ package mem
 import (
 	"fmt"
 
+	"google.golang.org/protobuf/encoding/protowire"
+
 	spb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/summary_go_proto"
 	tpb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/tensor_go_proto"
 	tspb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/tensor_shape_go_proto"
@@ -21,12 +23,31 @@ const runGraphName string = "__run_graph__"
 // TensorBoard plugin names; must agree with the `PLUGIN_NAME`s defined in
 // `tensorboard.plugin.*.metadata`.
 const (
-	graphsPluginName     = "graphs"
-	histogramsPluginName = "histograms"
-	imagesPluginName     = "images"
-	scalarsPluginName    = "scalars"
+	audioPluginName         = "audio"
+	customScalarsPluginName = "custom_scalars"
+	graphsPluginName        = "graphs"
+	histogramsPluginName    = "histograms"
+	hparamsPluginName       = "hparams"
+	imagesPluginName        = "images"
+	meshPluginName          = "mesh"
+	prCurvesPluginName      = "pr_curves"
+	scalarsPluginName       = "scalars"
+	textPluginName          = "text"
 )
 
+// audioPluginDataWAV is the wire encoding of a `tensorboard.AudioPluginData`
+// proto with `version: 0` and `encoding: WAV`, which is what legacy
+// `tf.summary.audio` ops always produce. Encoded by hand to avoid depending on
+// the audio plugin's protos.
+var audioPluginDataWAV = func() []byte {
+	const (
+		encodingField = 2
+		encodingWAV   = 11
+	)
+	buf := protowire.AppendTag(nil, encodingField, protowire.VarintType)
+	return protowire.AppendVarint(buf, encodingWAV)
+}()
+
 // EventValues converts an on-disk event to the summary values that it
 // represents, applying compatibility transformations. It updates the
 // MetadataStore with any new summary metadata, and may read from it to
@@ -145,6 +166,23 @@ func migrateValueInPlace(v *spb.Summary_Value, initialMeta *spb.SummaryMetadata)
 				DataClass: spb.DataClass_DATA_CLASS_TENSOR,
 			}
 		}
+	case *spb.Summary_Value_Audio:
+		au := what.Audio
+		tensor := &tpb.TensorProto{
+			Dtype:       dtpb.DataType_DT_STRING,
+			TensorShape: &tspb.TensorShapeProto{Dim: []*tspb.TensorShapeProto_Dim{{Size: 1}}},
+			StringVal:   [][]byte{au.EncodedAudioString},
+		}
+		v.Value = &spb.Summary_Value_Tensor{Tensor: tensor}
+		if initialMeta == nil {
+			v.Metadata = &spb.SummaryMetadata{
+				PluginData: &spb.SummaryMetadata_PluginData{
+					PluginName: audioPluginName,
+					Content:    audioPluginDataWAV,
+				},
+				DataClass: spb.DataClass_DATA_CLASS_BLOB_SEQUENCE,
+			}
+		}
 	case *spb.Summary_Value_Tensor:
 		migrateTensorInPlace(v, what.Tensor, initialMeta)
 	default:
@@ -153,15 +191,18 @@ func migrateValueInPlace(v *spb.Summary_Value, initialMeta *spb.SummaryMetadata)
 }
 
 func migrateTensorInPlace(v *spb.Summary_Value, tensor *tpb.TensorProto, initialMeta *spb.SummaryMetadata) {
-	var pluginName string
+	md := initialMeta
+	if md == nil {
+		md = v.Metadata
+	}
+	pluginName := md.GetPluginData().GetPluginName()
 	if initialMeta == nil {
-		pluginName = v.Metadata.GetPluginData().GetPluginName()
 		switch pluginName {
 		case scalarsPluginName:
 			v.Metadata.DataClass = spb.DataClass_DATA_CLASS_SCALAR
-		case imagesPluginName:
+		case imagesPluginName, audioPluginName:
 			v.Metadata.DataClass = spb.DataClass_DATA_CLASS_BLOB_SEQUENCE
-		case histogramsPluginName:
+		case histogramsPluginName, textPluginName, prCurvesPluginName, hparamsPluginName, customScalarsPluginName, meshPluginName:
 			v.Metadata.DataClass = spb.DataClass_DATA_CLASS_TENSOR
 		}
 	}
@@ -170,7 +211,30 @@ func migrateTensorInPlace(v *spb.Summary_Value, tensor *tpb.TensorProto, initial
 		// no transformations needed
 	case imagesPluginName:
 		// no transformations needed
+	case audioPluginName:
+		migrateAudioTensorInPlace(tensor)
 	case histogramsPluginName:
 		// no transformations needed
 	}
 }
+
+// migrateAudioTensorInPlace converts a tensor of shape [k, 2] holding audio
+// clips and their labels into a tensor of shape [k] holding just the audio
+// clips, so that it may be read as a blob sequence. Labels are discarded.
+// Tensors of any other shape are left alone.
+func migrateAudioTensorInPlace(tensor *tpb.TensorProto) {
+	dims := tensor.GetTensorShape().GetDim()
+	if len(dims) != 2 || dims[1].Size != 2 {
+		return
+	}
+	k := int(dims[0].Size)
+	if len(tensor.StringVal) != 2*k {
+		return
+	}
+	clips := make([][]byte, k)
+	for i := range clips {
+		clips[i] = tensor.StringVal[2*i]
+	}
+	tensor.TensorShape = &tspb.TensorShapeProto{Dim: []*tspb.TensorShapeProto_Dim{{Size: int64(k)}}}
+	tensor.StringVal = clips
+}
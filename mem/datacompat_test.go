@@ -276,3 +276,199 @@ func TestEventValuesGraphDef(t *testing.T) {
 		}
 	}
 }
+
+func TestEventValuesTensorDataClasses(t *testing.T) {
+	cases := []struct {
+		pluginName string
+		want       spb.DataClass
+	}{
+		{scalarsPluginName, spb.DataClass_DATA_CLASS_SCALAR},
+		{imagesPluginName, spb.DataClass_DATA_CLASS_BLOB_SEQUENCE},
+		{audioPluginName, spb.DataClass_DATA_CLASS_BLOB_SEQUENCE},
+		{histogramsPluginName, spb.DataClass_DATA_CLASS_TENSOR},
+		{textPluginName, spb.DataClass_DATA_CLASS_TENSOR},
+		{prCurvesPluginName, spb.DataClass_DATA_CLASS_TENSOR},
+		{hparamsPluginName, spb.DataClass_DATA_CLASS_TENSOR},
+		{customScalarsPluginName, spb.DataClass_DATA_CLASS_TENSOR},
+		{meshPluginName, spb.DataClass_DATA_CLASS_TENSOR},
+		{"some_unknown_plugin", spb.DataClass_DATA_CLASS_UNKNOWN},
+	}
+	for _, c := range cases {
+		mds := make(MetadataStore)
+		value := &spb.Summary_Value{
+			Tag: "mytag",
+			Value: &spb.Summary_Value_Tensor{Tensor: &tpb.TensorProto{
+				Dtype:       dtpb.DataType_DT_STRING,
+				TensorShape: &tspb.TensorShapeProto{},
+				StringVal:   [][]byte{[]byte("hello")},
+			}},
+			Metadata: &spb.SummaryMetadata{
+				PluginData: &spb.SummaryMetadata_PluginData{
+					PluginName: c.pluginName,
+					Content:    []byte("plugin content"),
+				},
+			},
+		}
+		event := &epb.Event{
+			Step: 0,
+			What: &epb.Event_Summary{Summary: &spb.Summary{Value: []*spb.Summary_Value{value}}},
+		}
+		values := EventValues(event, mds)
+		if len(values) != 1 {
+			t.Errorf("plugin %q: len(values): got %v, want 1: %v", c.pluginName, len(values), values)
+			continue
+		}
+		want := &spb.SummaryMetadata{
+			PluginData: &spb.SummaryMetadata_PluginData{
+				PluginName: c.pluginName,
+				Content:    []byte("plugin content"),
+			},
+			DataClass: c.want,
+		}
+		if got := values[0].Metadata; !proto.Equal(got, want) {
+			t.Errorf("plugin %q: values[0].Metadata: got %v, want %v", c.pluginName, got, want)
+		}
+		if got := mds["mytag"]; !proto.Equal(got, want) {
+			t.Errorf(`plugin %q: mds["mytag"]: got %v, want %v`, c.pluginName, got, want)
+		}
+	}
+}
+
+func TestEventValuesTFv1Audio(t *testing.T) {
+	audioSummary := func(buf string) *epb.Event_Summary {
+		au := &spb.Summary_Audio{
+			SampleRate:         44100,
+			NumChannels:        1,
+			LengthFrames:       4,
+			EncodedAudioString: []byte(buf),
+			ContentType:        "audio/wav",
+		}
+		return &epb.Event_Summary{Summary: &spb.Summary{
+			Value: []*spb.Summary_Value{
+				{Tag: "input/audio/0", Value: &spb.Summary_Value_Audio{Audio: au}},
+			},
+		}}
+	}
+
+	mds := make(MetadataStore)
+	events := []*epb.Event{
+		{Step: 0, WallTime: 1000.25, What: audioSummary("RIFF one")},
+		{Step: 1, WallTime: 1234.50, What: audioSummary("RIFF two")},
+	}
+	var values []*spb.Summary_Value
+	for _, e := range events {
+		values = append(values, EventValues(e, mds)...)
+	}
+
+	wantBufs := []string{"RIFF one", "RIFF two"}
+	if got, want := len(values), len(wantBufs); got != want {
+		t.Errorf("len(values): got %v, want %v: %v", got, want, values)
+		if got < want {
+			t.FailNow()
+		}
+	}
+
+	// Check metadata.
+	{
+		got := values[0].Metadata
+		want := &spb.SummaryMetadata{
+			DataClass: spb.DataClass_DATA_CLASS_BLOB_SEQUENCE,
+			PluginData: &spb.SummaryMetadata_PluginData{
+				PluginName: audioPluginName,
+				Content:    []byte("\x10\x0b"), // encoding: WAV
+			},
+		}
+		if !proto.Equal(got, want) {
+			t.Errorf("values[0].Metadata: got %v, want %v", got, want)
+		}
+		tag := "input/audio/0"
+		got = mds[tag]
+		if !proto.Equal(got, want) {
+			t.Errorf("mds[%q]: got %v, want %v", tag, got, want)
+		}
+	}
+	if got := values[1].Metadata; got != nil {
+		t.Errorf("values[1].Metadata: got %v, want nil", got)
+	}
+
+	// Check values.
+	for i, v := range values {
+		wantTensor := &tpb.TensorProto{
+			Dtype:       dtpb.DataType_DT_STRING,
+			TensorShape: &tspb.TensorShapeProto{Dim: []*tspb.TensorShapeProto_Dim{{Size: 1}}},
+			StringVal:   [][]byte{[]byte(wantBufs[i])},
+		}
+		if got := v.GetTensor(); !proto.Equal(got, wantTensor) {
+			t.Errorf("values[%v].Tensor: got %v, want %v", i, got, wantTensor)
+		}
+	}
+}
+
+func TestEventValuesTFv2Audio(t *testing.T) {
+	audioSummary := func(clips []string, includeMeta bool) *epb.Event_Summary {
+		var bufs [][]byte
+		for _, clip := range clips {
+			bufs = append(bufs, []byte(clip), []byte("label for "+clip))
+		}
+		tensor := &tpb.TensorProto{
+			Dtype: dtpb.DataType_DT_STRING,
+			TensorShape: &tspb.TensorShapeProto{
+				Dim: []*tspb.TensorShapeProto_Dim{{Size: int64(len(clips))}, {Size: 2}},
+			},
+			StringVal: bufs,
+		}
+		value := &spb.Summary_Value{
+			Tag:   "waveform",
+			Value: &spb.Summary_Value_Tensor{Tensor: tensor},
+		}
+		if includeMeta {
+			value.Metadata = &spb.SummaryMetadata{
+				PluginData: &spb.SummaryMetadata_PluginData{
+					PluginName: audioPluginName,
+				},
+			}
+		}
+		return &epb.Event_Summary{Summary: &spb.Summary{Value: []*spb.Summary_Value{value}}}
+	}
+
+	mds := make(MetadataStore)
+	events := []*epb.Event{
+		{Step: 0, WallTime: 1000.25, What: audioSummary([]string{"a0", "a1"}, true)},
+		{Step: 1, WallTime: 1234.50, What: audioSummary([]string{"b0", "b1", "b2"}, false)},
+	}
+	var values []*spb.Summary_Value
+	for _, e := range events {
+		values = append(values, EventValues(e, mds)...)
+	}
+
+	wantClipses := [][]string{{"a0", "a1"}, {"b0", "b1", "b2"}}
+	if got, want := len(values), len(wantClipses); got != want {
+		t.Errorf("len(values): got %v, want %v: %v", got, want, values)
+		if got < want {
+			t.FailNow()
+		}
+	}
+
+	if got, want := mds["waveform"].GetDataClass(), spb.DataClass_DATA_CLASS_BLOB_SEQUENCE; got != want {
+		t.Errorf(`mds["waveform"].DataClass: got %v, want %v`, got, want)
+	}
+
+	// Check values: labels should be stripped from every tensor, not just
+	// the one that carried the metadata.
+	for i, v := range values {
+		wantBufs := make([][]byte, len(wantClipses[i]))
+		for j, clip := range wantClipses[i] {
+			wantBufs[j] = []byte(clip)
+		}
+		wantTensor := &tpb.TensorProto{
+			Dtype: dtpb.DataType_DT_STRING,
+			TensorShape: &tspb.TensorShapeProto{
+				Dim: []*tspb.TensorShapeProto_Dim{{Size: int64(len(wantBufs))}},
+			},
+			StringVal: wantBufs,
+		}
+		if got := v.GetTensor(); !proto.Equal(got, wantTensor) {
+			t.Errorf("values[%v].Tensor: got %v, want %v", i, got, wantTensor)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package mem
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
 	"sync"
@@ -23,19 +24,85 @@ type EagerReservoir interface {
 	// Last returns the most recent record, or nil if no records have yet
 	// been offered.
 	Last() StepIndexed
+	// Len returns the number of records currently stored: i.e., the
+	// length of the slice that Sample would return.
+	Len() int
+	// Snapshot captures the full state of the reservoir, such that
+	// RestoreEagerReservoir yields a reservoir that behaves identically.
+	Snapshot() ReservoirSnapshot
+	// Version returns a summary of the records offered so far, which
+	// changes whenever a record is offered.
+	Version() ReservoirVersion
+}
+
+// A ReservoirVersion lets readers of an EagerReservoir cheaply tell how it has
+// changed since they last sampled it. Versions are not saved in snapshots.
+type ReservoirVersion struct {
+	// Offered is the number of records offered so far, including
+	// preempted ones.
+	Offered uint64
+	// Preemptions is the number of records whose arrival preempted
+	// earlier records. While it stays the same, records are only ever
+	// added after the last step.
+	Preemptions uint64
+}
+
+// A ReservoirSnapshot is the state of an EagerReservoir at a point in time.
+type ReservoirSnapshot struct {
+	// Capacity is the capacity with which the reservoir was created.
+	Capacity uint64
+	// Seen is the number of non-preempted records offered so far.
+	Seen int
+	// RNGState is the state of the reservoir's random number generator.
+	RNGState uint64
+	// Values holds the records currently stored, as returned by Sample.
+	Values []StepIndexed
 }
 
 // NewEagerReservoir creates an EagerReservoir with the given capacity. The
 // reservoir can hold up to capacity elements losslessly, and will start
-// downsampling after that many.
+// downsampling after that many. A capacity of zero means that the reservoir is
+// unbounded: it keeps every non-preempted record and never downsamples.
 func NewEagerReservoir(capacity uint64) EagerReservoir {
+	src := &splitMix64{}
 	return &eagerReservoir{
-		rng: rand.New(rand.NewSource(0)),
-		buf: make([]StepIndexed, capacity),
+		src:       src,
+		rng:       rand.New(src),
+		buf:       make([]StepIndexed, capacity),
+		unbounded: capacity == 0,
 	}
 }
 
+// RestoreEagerReservoir creates an EagerReservoir from a snapshot taken by
+// EagerReservoir.Snapshot. The snapshot's values must be in step order and
+// must fit within its capacity. The restored reservoir does not alias the
+// snapshot's Values slice.
+func RestoreEagerReservoir(s ReservoirSnapshot) (EagerReservoir, error) {
+	if s.Capacity != 0 && uint64(len(s.Values)) > s.Capacity {
+		return nil, fmt.Errorf("reservoir snapshot has %v values, over capacity %v", len(s.Values), s.Capacity)
+	}
+	if s.Seen < len(s.Values) {
+		return nil, fmt.Errorf("reservoir snapshot has %v values, but only %v seen", len(s.Values), s.Seen)
+	}
+	for i := 1; i < len(s.Values); i++ {
+		if s.Values[i-1].Step() >= s.Values[i].Step() {
+			return nil, fmt.Errorf("reservoir snapshot values not in step order: step %v before step %v", s.Values[i-1].Step(), s.Values[i].Step())
+		}
+	}
+	rsv := NewEagerReservoir(s.Capacity).(*eagerReservoir)
+	rsv.src.state = s.RNGState
+	rsv.seen = s.Seen
+	rsv.stored = len(s.Values)
+	if rsv.unbounded {
+		rsv.buf = make([]StepIndexed, len(s.Values))
+	}
+	copy(rsv.buf, s.Values)
+	return rsv, nil
+}
+
 type eagerReservoir struct {
+	// src is the source for rng, whose state is saved in snapshots.
+	src *splitMix64
 	// rng is used for determining whether and whither a given new record
 	// should be added to the reservoir, once the total number of records
 	// seen no longer fits in the reservoir capacity.
@@ -50,8 +117,13 @@ type eagerReservoir struct {
 	stored int
 	// buf stores. The slice length is always the capacity of the
 	// reservoir, but it may have a bunch of nils. Representation
-	// invariant: buf is stored in step-sorted order.
+	// invariant: buf is stored in step-sorted order. If unbounded, the
+	// slice instead grows as needed.
 	buf []StepIndexed
+	// unbounded is true if the reservoir has no capacity limit.
+	unbounded bool
+	// version counts records offered and preemptions, for Version.
+	version ReservoirVersion
 	// mutex protects access to all fields of the reservoir other than
 	// itself.
 	mutex sync.Mutex
@@ -63,7 +135,13 @@ func (rsv *eagerReservoir) Offer(v StepIndexed) {
 
 	rsv.lockedPreempt(v.Step())
 
+	rsv.version.Offered++
 	rsv.seen++
+	if rsv.unbounded {
+		rsv.buf = append(rsv.buf[:rsv.stored], v)
+		rsv.stored++
+		return
+	}
 	// Cast from int64 to int is portable because result of Int63n
 	// is always smaller than its argument, and its argument value
 	// was an int.
@@ -90,6 +168,7 @@ func (rsv *eagerReservoir) lockedPreempt(firstBad Step) {
 		preemptions++
 	}
 	if preemptions > 0 {
+		rsv.version.Preemptions++
 		facPreempted := float64(preemptions) / float64(rsv.stored)
 		rsv.stored -= preemptions
 		rsv.seen = int(math.Ceil(facPreempted * float64(rsv.seen)))
@@ -114,3 +193,35 @@ func (rsv *eagerReservoir) Last() StepIndexed {
 	}
 	return rsv.buf[rsv.stored-1]
 }
+
+func (rsv *eagerReservoir) Len() int {
+	rsv.mutex.Lock()
+	defer rsv.mutex.Unlock()
+
+	return rsv.stored
+}
+
+func (rsv *eagerReservoir) Snapshot() ReservoirSnapshot {
+	rsv.mutex.Lock()
+	defer rsv.mutex.Unlock()
+
+	var capacity uint64
+	if !rsv.unbounded {
+		capacity = uint64(len(rsv.buf))
+	}
+	values := make([]StepIndexed, rsv.stored)
+	copy(values, rsv.buf)
+	return ReservoirSnapshot{
+		Capacity: capacity,
+		Seen:     rsv.seen,
+		RNGState: rsv.src.state,
+		Values:   values,
+	}
+}
+
+func (rsv *eagerReservoir) Version() ReservoirVersion {
+	rsv.mutex.Lock()
+	defer rsv.mutex.Unlock()
+
+	return rsv.version
+}
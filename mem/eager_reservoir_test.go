@@ -145,3 +145,113 @@ func TestReservoirDeterministic(t *testing.T) {
 		r2.Offer(JustStep{step: Step(step)})
 	}
 }
+
+func TestReservoirSampleStable(t *testing.T) {
+	// Pins the points that a new reservoir keeps, which depend on its
+	// random number generator. If this changes, so does which points
+	// every user's reservoirs keep.
+	rsv := NewEagerReservoir(10)
+	for i := 0; i < 100; i++ {
+		rsv.Offer(JustStep{step: Step(i)})
+	}
+	want := []Step{0, 1, 3, 14, 46, 48, 52, 77, 90, 99}
+	if got := extractSteps(rsv); !stepsEqual(got, want) {
+		t.Errorf("sample: got %v, want %v", got, want)
+	}
+}
+
+func TestReservoirUnbounded(t *testing.T) {
+	rsv := NewEagerReservoir(0)
+
+	var expectedSteps []Step
+	for i := 0; i < 1000; i++ {
+		rsv.Offer(JustStep{step: Step(i)})
+		expectedSteps = append(expectedSteps, Step(i))
+	}
+	if s := extractSteps(rsv); !stepsEqual(s, expectedSteps) {
+		t.Errorf("after 1000 records: got %v, want %v", s, expectedSteps)
+	}
+
+	// Preempt to invalidate records 500..=999.
+	rsv.Offer(JustStep{step: 500})
+	expectedSteps = append(expectedSteps[:500], 500)
+	if s := extractSteps(rsv); !stepsEqual(s, expectedSteps) {
+		t.Errorf("after preemption: got %v, want %v", s, expectedSteps)
+	}
+	if got, want := rsv.Last(), Step(500); got == nil || got.Step() != want {
+		t.Errorf("after preemption: got last=%v, want step %v", got, want)
+	}
+}
+
+func TestReservoirLen(t *testing.T) {
+	rsv := NewEagerReservoir(10)
+	for i := 0; i < 20; i++ {
+		if got, want := rsv.Len(), len(rsv.Sample()); got != want {
+			t.Errorf("i=%v: Len(): got %v, want %v", i, got, want)
+		}
+		rsv.Offer(JustStep{step: Step(i)})
+	}
+	if got, want := rsv.Len(), 10; got != want {
+		t.Errorf("full reservoir: Len(): got %v, want %v", got, want)
+	}
+}
+
+func TestReservoirVersion(t *testing.T) {
+	rsv := NewEagerReservoir(3)
+	for _, step := range []Step{0, 1, 2, 3, 4} {
+		rsv.Offer(JustStep{step: step})
+	}
+	if got, want := rsv.Version(), (ReservoirVersion{Offered: 5}); got != want {
+		t.Errorf("after steps 0..4: got %+v, want %+v", got, want)
+	}
+	// Step 2 preempts steps 2 through 4; step 3 preempts nothing.
+	rsv.Offer(JustStep{step: 2})
+	rsv.Offer(JustStep{step: 3})
+	if got, want := rsv.Version(), (ReservoirVersion{Offered: 7, Preemptions: 1}); got != want {
+		t.Errorf("after preemption: got %+v, want %+v", got, want)
+	}
+}
+
+func TestReservoirSnapshot(t *testing.T) {
+	for _, capacity := range []uint64{0, 10} {
+		r1 := NewEagerReservoir(capacity)
+		for i := 0; i < 50; i++ {
+			r1.Offer(JustStep{step: Step(i)})
+		}
+		r2, err := RestoreEagerReservoir(r1.Snapshot())
+		if err != nil {
+			t.Fatalf("capacity=%v: RestoreEagerReservoir: %v", capacity, err)
+		}
+		for i := 50; i < 100; i++ {
+			if s1, s2 := extractSteps(r1), extractSteps(r2); !stepsEqual(s1, s2) {
+				t.Errorf("capacity=%v: i=%v: s1 != s2: %v != %v", capacity, i, s1, s2)
+			}
+			// Include a preemption, which depends on the seen count.
+			step := i
+			if step >= 80 {
+				step -= 20
+			}
+			r1.Offer(JustStep{step: Step(step)})
+			r2.Offer(JustStep{step: Step(step)})
+		}
+		if s1, s2 := r1.Snapshot(), r2.Snapshot(); s1.Seen != s2.Seen || s1.RNGState != s2.RNGState || s1.Capacity != capacity {
+			t.Errorf("capacity=%v: final snapshots differ: %+v != %+v", capacity, s1, s2)
+		}
+	}
+}
+
+func TestRestoreEagerReservoirInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		s    ReservoirSnapshot
+	}{
+		{"overCapacity", ReservoirSnapshot{Capacity: 1, Seen: 2, Values: []StepIndexed{JustStep{1}, JustStep{2}}}},
+		{"underSeen", ReservoirSnapshot{Capacity: 10, Seen: 1, Values: []StepIndexed{JustStep{1}, JustStep{2}}}},
+		{"unsorted", ReservoirSnapshot{Capacity: 10, Seen: 2, Values: []StepIndexed{JustStep{2}, JustStep{1}}}},
+	}
+	for _, test := range tests {
+		if _, err := RestoreEagerReservoir(test.s); err == nil {
+			t.Errorf("%s: got nil error, want error", test.name)
+		}
+	}
+}
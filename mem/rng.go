@@ -0,0 +1,24 @@
+package mem
+
+// splitMix64 is a rand.Source64 implementing the SplitMix64 generator. Unlike
+// the standard library's sources, its state is a single word that can be
+// saved and restored, so that reservoirs can be snapshotted.
+type splitMix64 struct {
+	state uint64
+}
+
+func (s *splitMix64) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (s *splitMix64) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func (s *splitMix64) Seed(seed int64) {
+	s.state = uint64(seed)
+}
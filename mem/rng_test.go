@@ -0,0 +1,16 @@
+package mem
+
+import (
+	"testing"
+)
+
+func TestSplitMix64(t *testing.T) {
+	// Reference outputs of SplitMix64 from state zero.
+	want := []uint64{0xe220a8397b1dcdaf, 0x6e789e6aa1b965f4, 0x06c45d188009454f, 0xf88bb8a8724c81ec}
+	s := &splitMix64{}
+	for i, w := range want {
+		if got := s.Uint64(); got != w {
+			t.Errorf("Uint64() #%v: got %#016x, want %#016x", i, got, w)
+		}
+	}
+}
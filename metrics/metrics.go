@@ -0,0 +1,30 @@
+// Package metrics holds the Prometheus registry and shared settings for
+// instrumentation throughout this module.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace is the common prefix of all metric names registered by this
+// module, for use as the Namespace of prometheus.Opts.
+const Namespace = "tensorboard_data_server"
+
+// Default is the registry used by instrumentation throughout this module.
+// Register metrics with promauto.With(Default).
+var Default = prometheus.NewRegistry()
+
+// Handler returns an http.Handler that serves all metrics in Default.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Default, promhttp.HandlerOpts{})
+}
+
+// DefaultBuckets are histogram bucket upper bounds suitable for latencies in
+// seconds.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// SizeBuckets are histogram bucket upper bounds suitable for sizes in bytes.
+var SizeBuckets = []float64{256, 1024, 4096, 16384, 65536, 262144, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
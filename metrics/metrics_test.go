@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+func TestHandler(t *testing.T) {
+	c := promauto.With(Default).NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "test_things_total",
+		Help:      "Number of things.",
+	}, []string{"kind"})
+	defer Default.Unregister(c)
+	c.WithLabelValues("a").Add(2)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`# TYPE tensorboard_data_server_test_things_total counter`,
+		`tensorboard_data_server_test_things_total{kind="a"} 2`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("exposition: got:\n%s\nwant line %q", body, want)
+		}
+	}
+}
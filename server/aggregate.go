@@ -0,0 +1,65 @@
+package server
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/wchargin/tensorboard-data-server/io/run"
+	dppb "github.com/wchargin/tensorboard-data-server/proto/data_provider_proto"
+)
+
+// aggregateScalars divides the steps spanned by a step-sorted sample of a
+// scalar time series into k buckets of equal width, and returns one point per
+// nonempty bucket: the last point in the bucket, along with the min, max, and
+// mean of its values. NaN values propagate to all three statistics. Panics if
+// k < 0.
+func aggregateScalars(sample []run.ValueDatum, k int) *dppb.ScalarData {
+	if k < 0 {
+		panic("aggregateScalars: negative k")
+	}
+	data := new(dppb.ScalarData)
+	if k == 0 || len(sample) == 0 {
+		return data
+	}
+	first := sample[0].EventStep
+	width := uint64(sample[len(sample)-1].EventStep - first)
+	// bucket returns the index of the bucket for a step. It computes
+	// (step - first) * k / width without overflow, clamping the last step
+	// into the last bucket.
+	bucket := func(d run.ValueDatum) int {
+		if width == 0 {
+			return 0
+		}
+		hi, lo := bits.Mul64(uint64(d.EventStep-first), uint64(k))
+		b, _ := bits.Div64(hi, lo, width)
+		if b >= uint64(k) {
+			return k - 1
+		}
+		return int(b)
+	}
+
+	start := 0
+	for start < len(sample) {
+		b := bucket(sample[start])
+		end := start + 1
+		for end < len(sample) && bucket(sample[end]) == b {
+			end++
+		}
+		min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+		for _, d := range sample[start:end] {
+			v := scalarValue(d.Value.GetTensor())
+			min = math.Min(min, v)
+			max = math.Max(max, v)
+			sum += v
+		}
+		last := sample[end-1]
+		data.Step = append(data.Step, int64(last.EventStep))
+		data.WallTime = append(data.WallTime, last.EventWallTime)
+		data.Value = append(data.Value, scalarValue(last.Value.GetTensor()))
+		data.Min = append(data.Min, min)
+		data.Max = append(data.Max, max)
+		data.Mean = append(data.Mean, sum/float64(end-start))
+		start = end
+	}
+	return data
+}
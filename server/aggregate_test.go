@@ -0,0 +1,93 @@
+package server
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/wchargin/tensorboard-data-server/io/run"
+	"github.com/wchargin/tensorboard-data-server/mem"
+	dppb "github.com/wchargin/tensorboard-data-server/proto/data_provider_proto"
+	"github.com/wchargin/tensorboard-data-server/summary"
+)
+
+// scalarSample creates a sample with the given steps and values, with wall
+// times of 1000 plus the step.
+func scalarSample(steps []int64, values []float64) []run.ValueDatum {
+	sample := make([]run.ValueDatum, len(steps))
+	for i, step := range steps {
+		sample[i] = run.ValueDatum{
+			EventStep:     mem.Step(step),
+			EventWallTime: float64(1000 + step),
+			Value:         summary.Scalar("loss", values[i]),
+		}
+	}
+	return sample
+}
+
+func TestAggregateScalars(t *testing.T) {
+	// Steps 0 through 9 span buckets of width 4.5 with k=2, and of width
+	// 3 with k=3 (with step 9 clamped into the last bucket).
+	steps := []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	values := []float64{5, 1, 9, 3, 7, 2, 8, 4, 6, 0}
+	sample := scalarSample(steps, values)
+	cases := []struct {
+		k    int
+		want *dppb.ScalarData
+	}{
+		{0, &dppb.ScalarData{}},
+		{1, &dppb.ScalarData{
+			Step:     []int64{9},
+			WallTime: []float64{1009},
+			Value:    []float64{0},
+			Min:      []float64{0},
+			Max:      []float64{9},
+			Mean:     []float64{4.5},
+		}},
+		{2, &dppb.ScalarData{
+			Step:     []int64{4, 9},
+			WallTime: []float64{1004, 1009},
+			Value:    []float64{7, 0},
+			Min:      []float64{1, 0},
+			Max:      []float64{9, 8},
+			Mean:     []float64{5, 4},
+		}},
+		{3, &dppb.ScalarData{
+			Step:     []int64{2, 5, 9},
+			WallTime: []float64{1002, 1005, 1009},
+			Value:    []float64{9, 2, 0},
+			Min:      []float64{1, 2, 0},
+			Max:      []float64{9, 7, 8},
+			Mean:     []float64{5, 4, 4.5},
+		}},
+	}
+	for _, c := range cases {
+		if got := aggregateScalars(sample, c.k); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("aggregateScalars(k=%v): got %v, want %v", c.k, got, c.want)
+		}
+	}
+
+	// With more buckets than points, every point gets its own bucket.
+	got := aggregateScalars(sample, 100)
+	if !int64SlicesEqual(got.Step, steps) || !reflect.DeepEqual(got.Min, values) || !reflect.DeepEqual(got.Max, values) {
+		t.Errorf("aggregateScalars(k=100): got %v, want each point in its own bucket", got)
+	}
+}
+
+func TestAggregateScalarsSparse(t *testing.T) {
+	// A gap in the steps leaves empty buckets, which are omitted. Extreme
+	// steps should not overflow.
+	steps := []int64{math.MinInt64, math.MinInt64 + 1, math.MaxInt64 - 1, math.MaxInt64}
+	got := aggregateScalars(scalarSample(steps, []float64{1, 2, 3, 4}), 10)
+	if want := []int64{math.MinInt64 + 1, math.MaxInt64}; !int64SlicesEqual(got.Step, want) {
+		t.Errorf("steps: got %v, want %v", got.Step, want)
+	}
+	if want := []float64{1.5, 3.5}; !reflect.DeepEqual(got.Mean, want) {
+		t.Errorf("means: got %v, want %v", got.Mean, want)
+	}
+
+	got = aggregateScalars(nil, 10)
+	if len(got.Step) != 0 || len(got.Min) != 0 {
+		t.Errorf("empty sample: got %v, want empty", got)
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"sort"
 )
@@ -35,3 +36,69 @@ func downsample(n int, k int, pick func(srcIndex, dstIndex int)) {
 		pick(src, dst)
 	}
 }
+
+// downsampleLTTB picks k elements from a sequence of n points in the plane,
+// using the Largest-Triangle-Three-Buckets algorithm to preserve the shape of
+// the curve through them. The points should be sorted by x coordinate. It will
+// always pick the last element, and the first element if k >= 2. Panics under
+// the same conditions as downsample. Argument pick will be called once for
+// each element picked, in increasing order of index.
+//
+// See: Sveinn Steinarsson, "Downsampling Time Series for Visual
+// Representation", 2013.
+func downsampleLTTB(n int, k int, x, y func(i int) float64, pick func(srcIndex, dstIndex int)) {
+	if n < 0 || k < 0 {
+		panic(fmt.Sprintf("downsampleLTTB got n=%v, k=%v; need non-negative", n, k))
+	}
+	if k > n {
+		panic(fmt.Sprintf("downsampleLTTB got n=%v, k=%v; need n >= k", n, k))
+	}
+	if n == 0 || k == 0 {
+		return
+	}
+	if k == n {
+		for i := 0; i < n; i++ {
+			pick(i, i)
+		}
+		return
+	}
+	if k == 1 {
+		pick(n-1, 0)
+		return
+	}
+
+	// The first and last points get buckets of their own, and the other
+	// n-2 points are divided into k-2 buckets. From each bucket, pick the
+	// point that forms the largest triangle with the previously picked
+	// point and the centroid of the next bucket.
+	bucketStart := func(b int) int { return b*(n-2)/(k-2) + 1 }
+	pick(0, 0)
+	prev := 0
+	for b := 0; b < k-2; b++ {
+		lo, hi := bucketStart(b), bucketStart(b+1)
+		nextLo, nextHi := hi, bucketStart(b+2)
+		if nextHi > n {
+			nextHi = n
+		}
+		var cx, cy float64
+		for i := nextLo; i < nextHi; i++ {
+			cx += x(i)
+			cy += y(i)
+		}
+		cx /= float64(nextHi - nextLo)
+		cy /= float64(nextHi - nextLo)
+
+		px, py := x(prev), y(prev)
+		best, bestArea := lo, -1.0
+		for i := lo; i < hi; i++ {
+			// Twice the triangle's area; NaN areas never win.
+			area := math.Abs((px-cx)*(y(i)-py) - (px-x(i))*(cy-py))
+			if area > bestArea {
+				best, bestArea = i, area
+			}
+		}
+		pick(best, b+1)
+		prev = best
+	}
+	pick(n-1, k-1)
+}
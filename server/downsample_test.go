@@ -1,6 +1,8 @@
 package server
 
 import (
+	"math"
+	"math/rand"
 	"sort"
 	"strings"
 	"testing"
@@ -19,6 +21,19 @@ func stringSlicesEqual(xs, ys []string) bool {
 	return true
 }
 
+func int64SlicesEqual(xs, ys []int64) bool {
+	if len(xs) != len(ys) {
+		return false
+	}
+	for i, x := range xs {
+		y := ys[i]
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
 func TestDownsampleEqualSize(t *testing.T) {
 	src := strings.Fields("one two three four five six seven eight")
 	dst := make([]string, len(src))
@@ -54,3 +69,87 @@ func TestDownsampleProperties(t *testing.T) {
 		}
 	}
 }
+
+// lttbIndices runs downsampleLTTB over the given y values, plotted against
+// x = i*i, and returns the picked source indices, failing the test if pick
+// isn't called once for each destination index in order.
+func lttbIndices(t *testing.T, ys []float64, k int) []int {
+	var picked []int
+	downsampleLTTB(len(ys), k, func(i int) float64 { return float64(i * i) }, func(i int) float64 { return ys[i] }, func(i, j int) {
+		if j != len(picked) {
+			t.Fatalf("pick(%v, %v): want destination index %v (n=%v, k=%v)", i, j, len(picked), len(ys), k)
+		}
+		picked = append(picked, i)
+	})
+	return picked
+}
+
+// TestDownsampleLTTBProperties performs a parameter sweep over `n` and `k`,
+// and verifies that the downsampled output (a) has exactly `k` elements, (b)
+// starts with the first input element if `k` >= 2, (c) ends with the last
+// input element, (d) has strictly increasing input indices, so that steps are
+// monotone, and (e) is the same on every run.
+func TestDownsampleLTTBProperties(t *testing.T) {
+	for n := 0; n < 60; n++ {
+		rng := rand.New(rand.NewSource(int64(n)))
+		ys := make([]float64, n)
+		for i := range ys {
+			ys[i] = rng.NormFloat64()
+		}
+		for k := 0; k <= n; k++ {
+			picked := lttbIndices(t, ys, k)
+			if len(picked) != k {
+				t.Errorf("got %v picks, want %v (n=%v, k=%v)", len(picked), k, n, k)
+				continue
+			}
+			if k == 0 {
+				continue
+			}
+			if k >= 2 && picked[0] != 0 {
+				t.Errorf("picked %v, want first index 0 (n=%v, k=%v)", picked, n, k)
+			}
+			if picked[k-1] != n-1 {
+				t.Errorf("picked %v, want last index %v (n=%v, k=%v)", picked, n-1, n, k)
+			}
+			for i := 1; i < k; i++ {
+				if picked[i] <= picked[i-1] {
+					t.Errorf("picked %v, want strictly increasing (n=%v, k=%v)", picked, n, k)
+					break
+				}
+			}
+			again := lttbIndices(t, ys, k)
+			for i := range picked {
+				if again[i] != picked[i] {
+					t.Errorf("picked %v, then %v; want deterministic (n=%v, k=%v)", picked, again, n, k)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestDownsampleLTTBKeepsSpike(t *testing.T) {
+	ys := make([]float64, 100)
+	ys[37] = 1000
+	picked := lttbIndices(t, ys, 5)
+	found := false
+	for _, i := range picked {
+		if i == 37 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("picked %v, want spike at index 37", picked)
+	}
+}
+
+func TestDownsampleLTTBNaN(t *testing.T) {
+	ys := make([]float64, 20)
+	for i := range ys {
+		ys[i] = math.NaN()
+	}
+	ys[5] = 1
+	if picked := lttbIndices(t, ys, 4); len(picked) != 4 {
+		t.Errorf("picked %v, want 4 points", picked)
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"path"
+	"regexp"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/wchargin/tensorboard-data-server/io/run"
+	"github.com/wchargin/tensorboard-data-server/mem"
+	dppb "github.com/wchargin/tensorboard-data-server/proto/data_provider_proto"
+)
+
+// A stringFilter is a predicate for strings, compiled from a RunFilter or
+// TagFilter. A nil *stringFilter matches all strings.
+type stringFilter struct {
+	// names holds exact strings to match.
+	names map[string]struct{}
+	// globs holds patterns for path.Match, already validated.
+	globs []string
+	// regexes holds patterns that match if they match any substring.
+	regexes []*regexp.Regexp
+	// negate inverts the result of the filter.
+	negate bool
+}
+
+// newStringFilter compiles a stringFilter. The field name is used to describe
+// invalid patterns in errors, which have code InvalidArgument.
+func newStringFilter(field string, names []string, globs []string, regexes []string, negate bool) (*stringFilter, error) {
+	f := &stringFilter{
+		names:   make(map[string]struct{}, len(names)),
+		globs:   globs,
+		regexes: make([]*regexp.Regexp, len(regexes)),
+		negate:  negate,
+	}
+	for _, name := range names {
+		f.names[name] = struct{}{}
+	}
+	for i, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s.globs[%d]: invalid glob %q: %v", field, i, glob, err)
+		}
+	}
+	for i, expr := range regexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s.regexes[%d]: invalid regex %q: %v", field, i, expr, err)
+		}
+		f.regexes[i] = re
+	}
+	return f, nil
+}
+
+func matchesFilter(f *stringFilter, x string) bool {
+	if f == nil {
+		return true
+	}
+	return f.matchesAny(x) != f.negate
+}
+
+// matchesAny tests whether x matches any of the names or patterns in f,
+// ignoring f.negate.
+func (f *stringFilter) matchesAny(x string) bool {
+	if _, ok := f.names[x]; ok {
+		return true
+	}
+	for _, glob := range f.globs {
+		if ok, _ := path.Match(glob, x); ok {
+			return true
+		}
+	}
+	for _, re := range f.regexes {
+		if re.MatchString(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// runsFilter compiles a *RunFilter, which may be nil, naming it field in
+// errors.
+func runsFilter(field string, rf *dppb.RunFilter) (*stringFilter, error) {
+	if rf == nil {
+		return nil, nil
+	}
+	return newStringFilter(field, rf.Runs, rf.Globs, rf.Regexes, rf.Negate)
+}
+
+// tagsFilter compiles a *TagFilter, which may be nil, naming it field in
+// errors.
+func tagsFilter(field string, tf *dppb.TagFilter) (*stringFilter, error) {
+	if tf == nil {
+		return nil, nil
+	}
+	return newStringFilter(field, tf.Tags, tf.Globs, tf.Regexes, tf.Negate)
+}
+
+// filters compiles two stringFilters from a *RunTagFilter, which may be nil.
+// Errors have code InvalidArgument.
+func filters(rtf *dppb.RunTagFilter) (runs *stringFilter, tags *stringFilter, err error) {
+	if runs, err = runsFilter("run_tag_filter.runs", rtf.GetRuns()); err != nil {
+		return nil, nil, err
+	}
+	if tags, err = tagsFilter("run_tag_filter.tags", rtf.GetTags()); err != nil {
+		return nil, nil, err
+	}
+	return runs, tags, nil
+}
+
+// A pointFilter restricts a time series to points within a range of steps and
+// a range of wall times, either of which may be nil to match everything.
+type pointFilter struct {
+	steps     *dppb.StepRange
+	wallTimes *dppb.WallTimeRange
+}
+
+// newPointFilter validates a StepRange and a WallTimeRange, each of which may
+// be nil. Errors have code InvalidArgument.
+func newPointFilter(sr *dppb.StepRange, wtr *dppb.WallTimeRange) (pointFilter, error) {
+	if sr != nil && sr.MinStep > sr.MaxStep {
+		return pointFilter{}, status.Errorf(codes.InvalidArgument, "step_range: min_step %v exceeds max_step %v", sr.MinStep, sr.MaxStep)
+	}
+	if wtr != nil && !(wtr.MinWallTime <= wtr.MaxWallTime) {
+		return pointFilter{}, status.Errorf(codes.InvalidArgument, "wall_time_range: want min_wall_time <= max_wall_time, got %v and %v", wtr.MinWallTime, wtr.MaxWallTime)
+	}
+	return pointFilter{steps: sr, wallTimes: wtr}, nil
+}
+
+// apply returns the points of a step-sorted sample that match f. The result
+// may share storage with the sample.
+func (f pointFilter) apply(sample []run.ValueDatum) []run.ValueDatum {
+	if sr := f.steps; sr != nil {
+		lo := sort.Search(len(sample), func(i int) bool { return sample[i].EventStep >= mem.Step(sr.MinStep) })
+		hi := sort.Search(len(sample), func(i int) bool { return sample[i].EventStep > mem.Step(sr.MaxStep) })
+		sample = sample[lo:hi]
+	}
+	if wtr := f.wallTimes; wtr != nil {
+		// Wall times need not increase with step, so check every point.
+		var result []run.ValueDatum
+		for _, d := range sample {
+			if wtr.MinWallTime <= d.EventWallTime && d.EventWallTime <= wtr.MaxWallTime {
+				result = append(result, d)
+			}
+		}
+		sample = result
+	}
+	return sample
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/wchargin/tensorboard-data-server/io/run"
+	"github.com/wchargin/tensorboard-data-server/mem"
+	dppb "github.com/wchargin/tensorboard-data-server/proto/data_provider_proto"
+)
+
+func TestFilters(t *testing.T) {
+	tags := []string{"loss", "accuracy", "layer_1/grad_norm", "layer_2/grad_norm", "layer_2/weights/grad_norm"}
+	cases := []struct {
+		name   string
+		filter *dppb.TagFilter
+		want   []string
+	}{
+		{"nil", nil, tags},
+		{"empty", &dppb.TagFilter{}, nil},
+		{"empty negated", &dppb.TagFilter{Negate: true}, tags},
+		{"exact", &dppb.TagFilter{Tags: []string{"loss", "nope"}}, []string{"loss"}},
+		{"glob", &dppb.TagFilter{Globs: []string{"layer_*/grad_norm"}}, []string{"layer_1/grad_norm", "layer_2/grad_norm"}},
+		{"regex", &dppb.TagFilter{Regexes: []string{"grad_norm$"}}, []string{"layer_1/grad_norm", "layer_2/grad_norm", "layer_2/weights/grad_norm"}},
+		{"anchored regex", &dppb.TagFilter{Regexes: []string{"^acc"}}, []string{"accuracy"}},
+		{
+			"union",
+			&dppb.TagFilter{Tags: []string{"loss"}, Globs: []string{"layer_1/*"}, Regexes: []string{"^acc"}},
+			[]string{"loss", "accuracy", "layer_1/grad_norm"},
+		},
+		{"negated", &dppb.TagFilter{Globs: []string{"layer_*/*"}, Negate: true}, []string{"loss", "accuracy", "layer_2/weights/grad_norm"}},
+	}
+	for _, c := range cases {
+		_, f, err := filters(&dppb.RunTagFilter{Tags: c.filter})
+		if err != nil {
+			t.Errorf("%s: filters: unexpected error: %v", c.name, err)
+			continue
+		}
+		var got []string
+		for _, tag := range tags {
+			if matchesFilter(f, tag) {
+				got = append(got, tag)
+			}
+		}
+		if !stringSlicesEqual(got, c.want) {
+			t.Errorf("%s: matched tags: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestFiltersInvalid(t *testing.T) {
+	cases := []struct {
+		rtf       *dppb.RunTagFilter
+		wantField string
+	}{
+		{&dppb.RunTagFilter{Runs: &dppb.RunFilter{Globs: []string{"ok", "train["}}}, "run_tag_filter.runs.globs[1]"},
+		{&dppb.RunTagFilter{Tags: &dppb.TagFilter{Regexes: []string{"(unclosed"}}}, "run_tag_filter.tags.regexes[0]"},
+	}
+	for _, c := range cases {
+		_, _, err := filters(c.rtf)
+		if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), c.wantField) {
+			t.Errorf("filters(%v): got error %v, want InvalidArgument mentioning %q", c.rtf, err, c.wantField)
+		}
+	}
+}
+
+func TestPointFilter(t *testing.T) {
+	// Wall times decrease partway through, as after a restart.
+	var sample []run.ValueDatum
+	for i, wt := range []float64{10, 20, 30, 40, 15, 25} {
+		sample = append(sample, run.ValueDatum{EventStep: mem.Step(i * 10), EventWallTime: wt})
+	}
+	cases := []struct {
+		name string
+		sr   *dppb.StepRange
+		wtr  *dppb.WallTimeRange
+		want []int64
+	}{
+		{"none", nil, nil, []int64{0, 10, 20, 30, 40, 50}},
+		{"steps", &dppb.StepRange{MinStep: 10, MaxStep: 30}, nil, []int64{10, 20, 30}},
+		{"steps between points", &dppb.StepRange{MinStep: 11, MaxStep: 19}, nil, nil},
+		{"steps past end", &dppb.StepRange{MinStep: 45, MaxStep: math.MaxInt64}, nil, []int64{50}},
+		{"negative steps", &dppb.StepRange{MinStep: math.MinInt64, MaxStep: 0}, nil, []int64{0}},
+		{"wall times", nil, &dppb.WallTimeRange{MinWallTime: 15, MaxWallTime: 25}, []int64{10, 40, 50}},
+		{"unbounded wall times", nil, &dppb.WallTimeRange{MinWallTime: math.Inf(-1), MaxWallTime: math.Inf(1)}, []int64{0, 10, 20, 30, 40, 50}},
+		{
+			"both",
+			&dppb.StepRange{MinStep: 20, MaxStep: 50},
+			&dppb.WallTimeRange{MinWallTime: 20, MaxWallTime: 30},
+			[]int64{20, 50},
+		},
+	}
+	for _, c := range cases {
+		f, err := newPointFilter(c.sr, c.wtr)
+		if err != nil {
+			t.Errorf("%s: newPointFilter: unexpected error: %v", c.name, err)
+			continue
+		}
+		var got []int64
+		for _, d := range f.apply(sample) {
+			got = append(got, int64(d.EventStep))
+		}
+		if !int64SlicesEqual(got, c.want) {
+			t.Errorf("%s: steps: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPointFilterInvalid(t *testing.T) {
+	cases := []struct {
+		sr        *dppb.StepRange
+		wtr       *dppb.WallTimeRange
+		wantField string
+	}{
+		{&dppb.StepRange{MinStep: 2, MaxStep: 1}, nil, "step_range"},
+		{nil, &dppb.WallTimeRange{MinWallTime: 2, MaxWallTime: 1}, "wall_time_range"},
+		{nil, &dppb.WallTimeRange{MinWallTime: math.NaN(), MaxWallTime: 1}, "wall_time_range"},
+	}
+	for _, c := range cases {
+		_, err := newPointFilter(c.sr, c.wtr)
+		if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), c.wantField) {
+			t.Errorf("newPointFilter(%v, %v): got error %v, want InvalidArgument mentioning %q", c.sr, c.wtr, err, c.wantField)
+		}
+	}
+}
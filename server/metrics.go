@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/wchargin/tensorboard-data-server/metrics"
+)
+
+var (
+	rpcLatency = promauto.With(metrics.Default).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Time taken to handle an RPC, by method and status code.",
+		Buckets:   metrics.DefaultBuckets,
+	}, []string{"method", "code"})
+	rpcResponseSize = promauto.With(metrics.Default).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Name:      "rpc_response_size_bytes",
+		Help:      "Total size of the response messages of an RPC, by method.",
+		Buckets:   metrics.SizeBuckets,
+	}, []string{"method"})
+)
+
+// UnaryMetricsInterceptor is a grpc.UnaryServerInterceptor that records RPC
+// latency and response size metrics.
+func UnaryMetricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	res, err := handler(ctx, req)
+	rpcLatency.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+	if msg, ok := res.(proto.Message); ok && err == nil {
+		rpcResponseSize.WithLabelValues(info.FullMethod).Observe(float64(proto.Size(msg)))
+	}
+	return res, err
+}
+
+// StreamMetricsInterceptor is a grpc.StreamServerInterceptor that records RPC
+// latency and response size metrics. The response size is the total size of
+// all messages sent on the stream.
+func StreamMetricsInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	cs := &countingServerStream{ServerStream: ss}
+	err := handler(srv, cs)
+	rpcLatency.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+	if err == nil {
+		rpcResponseSize.WithLabelValues(info.FullMethod).Observe(float64(cs.bytesSent))
+	}
+	return err
+}
+
+// countingServerStream wraps a grpc.ServerStream to count the bytes of all
+// messages sent.
+type countingServerStream struct {
+	grpc.ServerStream
+	bytesSent int
+}
+
+func (cs *countingServerStream) SendMsg(m interface{}) error {
+	if msg, ok := m.(proto.Message); ok {
+		cs.bytesSent += proto.Size(msg)
+	}
+	return cs.ServerStream.SendMsg(m)
+}
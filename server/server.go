@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"log"
 	"math"
+	"sort"
+	"sync"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -21,7 +23,13 @@ import (
 // Server implements the TensorBoardDataProviderServer interface.
 type Server struct {
 	dppb.UnimplementedTensorBoardDataProviderServer
-	ll *logdir.Loader
+	// ll, if non-nil, serves every experiment ID. Otherwise, lls maps
+	// each known experiment ID to its loader.
+	ll  *logdir.Loader
+	lls map[string]*logdir.Loader
+	// shutdown is closed by Shutdown to end streaming RPCs.
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
 const (
@@ -34,32 +42,79 @@ const (
 	blobBatchSizeBytes = 1024 * 1024 * 8
 )
 
-// NewServer creates an RPC server wrapper around a *logdir.Loader.
+// NewServer creates an RPC server wrapper around a *logdir.Loader. The loader
+// serves requests for every experiment ID.
 func NewServer(ll *logdir.Loader) *Server {
-	return &Server{ll: ll}
+	return &Server{ll: ll, shutdown: make(chan struct{})}
 }
 
-// ListRuns handles the ListRuns RPC.
+// NewMultiServer creates an RPC server wrapper around several loaders, keyed
+// by experiment ID. Requests for experiment IDs not in the map fail with code
+// NotFound. The map must not be modified after it is passed to NewMultiServer.
+func NewMultiServer(lls map[string]*logdir.Loader) *Server {
+	return &Server{lls: lls, shutdown: make(chan struct{})}
+}
+
+// loader returns the loader for the given experiment ID, or a NotFound error
+// if there is no such experiment.
+func (s *Server) loader(eid string) (*logdir.Loader, error) {
+	if s.ll != nil {
+		return s.ll, nil
+	}
+	if ll, ok := s.lls[eid]; ok {
+		return ll, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "no such experiment: %q", eid)
+}
+
+// Shutdown ends all current and future WatchScalars streams with code
+// Unavailable, so that a graceful stop of the enclosing gRPC server need not
+// wait for clients to hang up. Other RPCs are unaffected. Shutdown may be
+// called more than once.
+func (s *Server) Shutdown() {
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+}
+
+// ListRuns handles the ListRuns RPC. Runs are listed in lexicographic order of
+// name. A run's start time is the earliest wall time of any event in the run,
+// or zero if no events have been read yet.
 func (s *Server) ListRuns(ctx context.Context, req *dppb.ListRunsRequest) (*dppb.ListRunsResponse, error) {
+	ll, err := s.loader(req.ExperimentId)
+	if err != nil {
+		return nil, err
+	}
 	res := new(dppb.ListRunsResponse)
-	runs := s.ll.Runs()
-	res.Runs = make([]*dppb.Run, len(runs))
+	runs := ll.Runs()
+	names := make([]string, len(runs))
 	{
 		i := 0
-		for run := range s.ll.Runs() {
-			res.Runs[i] = &dppb.Run{Id: run, Name: run}
+		for run := range runs {
+			names[i] = run
 			i++
 		}
 	}
+	sort.Strings(names)
+	res.Runs = make([]*dppb.Run, len(names))
+	for i, run := range names {
+		startTime, _ := runs[run].StartTime()
+		res.Runs[i] = &dppb.Run{Id: run, Name: run, StartTime: startTime}
+	}
 	return res, nil
 }
 
 // ListScalars handles the ListScalars RPC.
 func (s *Server) ListScalars(ctx context.Context, req *dppb.ListScalarsRequest) (*dppb.ListScalarsResponse, error) {
+	ll, err := s.loader(req.ExperimentId)
+	if err != nil {
+		return nil, err
+	}
 	res := new(dppb.ListScalarsResponse)
-	runFilter, tagFilter := filters(req.RunTagFilter)
+	runFilter, tagFilter, err := filters(req.RunTagFilter)
+	if err != nil {
+		return nil, err
+	}
 
-	for run, acc := range s.ll.Runs() {
+	for run, acc := range ll.Runs() {
 		if !matchesFilter(runFilter, run) {
 			continue
 		}
@@ -103,14 +158,29 @@ func (s *Server) ListScalars(ctx context.Context, req *dppb.ListScalarsRequest)
 
 // ReadScalars handles the ReadScalars RPC.
 func (s *Server) ReadScalars(ctx context.Context, req *dppb.ReadScalarsRequest) (*dppb.ReadScalarsResponse, error) {
+	ll, err := s.loader(req.ExperimentId)
+	if err != nil {
+		return nil, err
+	}
 	res := new(dppb.ReadScalarsResponse)
-	runFilter, tagFilter := filters(req.RunTagFilter)
+	runFilter, tagFilter, err := filters(req.RunTagFilter)
+	if err != nil {
+		return nil, err
+	}
 	numPoints := int(req.Downsample.GetNumPoints())
 	if numPoints < 0 {
 		return nil, status.Errorf(codes.InvalidArgument, "downsample.num_points: want non-negative, got %v", numPoints)
 	}
+	method, err := downsampleMethod(req.Downsample, dppb.Downsample_METHOD_SAMPLE, dppb.Downsample_METHOD_AGGREGATE, dppb.Downsample_METHOD_LTTB)
+	if err != nil {
+		return nil, err
+	}
+	window, err := newPointFilter(req.StepRange, req.WallTimeRange)
+	if err != nil {
+		return nil, err
+	}
 
-	for run, acc := range s.ll.Runs() {
+	for run, acc := range ll.Runs() {
 		if !matchesFilter(runFilter, run) {
 			continue
 		}
@@ -125,20 +195,19 @@ func (s *Server) ReadScalars(ctx context.Context, req *dppb.ReadScalarsRequest)
 			if !matchesFilter(tagFilter, tag) {
 				continue
 			}
-			sample := downsampleValueData(acc.Sample(tag), numPoints)
-			data := dppb.ScalarData{
-				Step:     make([]int64, len(sample)),
-				WallTime: make([]float64, len(sample)),
-				Value:    make([]float64, len(sample)),
-			}
-			for i, x := range sample {
-				data.Step[i] = int64(x.EventStep)
-				data.WallTime[i] = x.EventWallTime
-				data.Value[i] = scalarValue(x.Value.GetTensor())
+			sample := window.apply(acc.Sample(tag))
+			var data *dppb.ScalarData
+			switch method {
+			case dppb.Downsample_METHOD_AGGREGATE:
+				data = aggregateScalars(sample, numPoints)
+			case dppb.Downsample_METHOD_LTTB:
+				data = scalarData(lttbValueData(sample, numPoints))
+			default:
+				data = scalarData(downsampleValueData(sample, numPoints))
 			}
 			e := &dppb.ReadScalarsResponse_TagEntry{
 				TagName: tag,
-				Data:    &data,
+				Data:    data,
 			}
 			tags = append(tags, e)
 		}
@@ -153,12 +222,160 @@ func (s *Server) ReadScalars(ctx context.Context, req *dppb.ReadScalarsRequest)
 	return res, nil
 }
 
+// A runTag identifies a time series within an experiment.
+type runTag struct {
+	run string
+	tag string
+}
+
+// A watchState records what a WatchScalars stream has sent for one time series.
+type watchState struct {
+	// acc is the accumulator last sampled, or nil if the time series has
+	// not been sampled on this stream. A run that is removed and created
+	// again gets a new accumulator, whose versions start over.
+	acc *run.Accumulator
+	// version is the version of the reservoir when last sampled.
+	version mem.ReservoirVersion
+	// step is the largest step sent, or the client's last seen step.
+	step mem.Step
+}
+
+// WatchScalars handles the WatchScalars RPC. It sends new points after each
+// reload of the log directory, until the client cancels the stream. Within each
+// response, runs and tags are sorted by name.
+//
+// Time series are tracked by reservoir version, so a reservoir is only sampled
+// when it has changed. When a reservoir's steps have gone backwards, its whole
+// sample is sent again, downsampled as for a time series sent in full. New
+// points that the reservoir evicts before the next reload are never sent, just
+// as they would be missing from a ReadScalars response.
+func (s *Server) WatchScalars(req *dppb.WatchScalarsRequest, stream dppb.TensorBoardDataProvider_WatchScalarsServer) error {
+	ll, err := s.loader(req.ExperimentId)
+	if err != nil {
+		return err
+	}
+	runFilter, tagFilter, err := filters(req.RunTagFilter)
+	if err != nil {
+		return err
+	}
+	numPoints := int(req.Downsample.GetNumPoints())
+	if numPoints < 0 {
+		return status.Errorf(codes.InvalidArgument, "downsample.num_points: want non-negative, got %v", numPoints)
+	}
+	method, err := downsampleMethod(req.Downsample, dppb.Downsample_METHOD_SAMPLE, dppb.Downsample_METHOD_LTTB)
+	if err != nil {
+		return err
+	}
+	// full downsamples a sample that is sent in full.
+	full := func(sample []run.ValueDatum) []run.ValueDatum {
+		switch {
+		case req.Downsample == nil:
+			return sample
+		case method == dppb.Downsample_METHOD_LTTB:
+			return lttbValueData(sample, numPoints)
+		default:
+			return downsampleValueData(sample, numPoints)
+		}
+	}
+	sent := make(map[runTag]watchState)
+	for _, ls := range req.LastSeen {
+		sent[runTag{ls.RunName, ls.TagName}] = watchState{step: mem.Step(ls.Step)}
+	}
+
+	for {
+		// Subscribe before reading so that no reload is missed.
+		reloaded := ll.Reloaded()
+		res := new(dppb.WatchScalarsResponse)
+		for run, acc := range ll.Runs() {
+			if !matchesFilter(runFilter, run) {
+				continue
+			}
+			var tags []*dppb.WatchScalarsResponse_TagEntry
+			for tag, md := range acc.List() {
+				if md == nil || md.DataClass != spb.DataClass_DATA_CLASS_SCALAR {
+					continue
+				}
+				if md.PluginData.GetPluginName() != req.PluginFilter.GetPluginName() {
+					continue
+				}
+				if !matchesFilter(tagFilter, tag) {
+					continue
+				}
+				key := runTag{run, tag}
+				// Read the version before sampling, so that any
+				// later change is seen on the next reload.
+				version := acc.Version(tag)
+				st, seen := sent[key]
+				if st.acc == acc && st.version == version {
+					continue
+				}
+				sample := acc.Sample(tag)
+				if len(sample) == 0 {
+					continue
+				}
+				last := sample[len(sample)-1].EventStep
+				var replace bool
+				if seen {
+					resampled := st.acc != nil && (st.acc != acc || st.version.Preemptions != version.Preemptions)
+					replace = resampled || last < st.step
+				}
+				sent[key] = watchState{acc: acc, version: version, step: last}
+				if seen && !replace {
+					sample = valueDataAfter(sample, st.step)
+				} else {
+					sample = full(sample)
+				}
+				if len(sample) == 0 {
+					continue
+				}
+				e := &dppb.WatchScalarsResponse_TagEntry{
+					TagName: tag,
+					Data:    scalarData(sample),
+					Replace: replace,
+				}
+				tags = append(tags, e)
+			}
+			if tags != nil {
+				sort.Slice(tags, func(i, j int) bool { return tags[i].TagName < tags[j].TagName })
+				e := &dppb.WatchScalarsResponse_RunEntry{
+					RunName: run,
+					Tags:    tags,
+				}
+				res.Runs = append(res.Runs, e)
+			}
+		}
+		if res.Runs != nil {
+			// Sort, as in ListRuns, so that successive responses can be
+			// compared.
+			sort.Slice(res.Runs, func(i, j int) bool { return res.Runs[i].RunName < res.Runs[j].RunName })
+			if err := stream.Send(res); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-reloaded:
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-s.shutdown:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
 // ListTensors handles the ListTensors RPC.
 func (s *Server) ListTensors(ctx context.Context, req *dppb.ListTensorsRequest) (*dppb.ListTensorsResponse, error) {
+	ll, err := s.loader(req.ExperimentId)
+	if err != nil {
+		return nil, err
+	}
 	res := new(dppb.ListTensorsResponse)
-	runFilter, tagFilter := filters(req.RunTagFilter)
+	runFilter, tagFilter, err := filters(req.RunTagFilter)
+	if err != nil {
+		return nil, err
+	}
 
-	for run, acc := range s.ll.Runs() {
+	for run, acc := range ll.Runs() {
 		if !matchesFilter(runFilter, run) {
 			continue
 		}
@@ -202,14 +419,28 @@ func (s *Server) ListTensors(ctx context.Context, req *dppb.ListTensorsRequest)
 
 // ReadTensors handles the ReadTensors RPC.
 func (s *Server) ReadTensors(ctx context.Context, req *dppb.ReadTensorsRequest) (*dppb.ReadTensorsResponse, error) {
+	ll, err := s.loader(req.ExperimentId)
+	if err != nil {
+		return nil, err
+	}
 	res := new(dppb.ReadTensorsResponse)
-	runFilter, tagFilter := filters(req.RunTagFilter)
+	runFilter, tagFilter, err := filters(req.RunTagFilter)
+	if err != nil {
+		return nil, err
+	}
 	numPoints := int(req.Downsample.GetNumPoints())
 	if numPoints < 0 {
 		return nil, status.Errorf(codes.InvalidArgument, "downsample.num_points: want non-negative, got %v", numPoints)
 	}
+	if _, err := downsampleMethod(req.Downsample, dppb.Downsample_METHOD_SAMPLE); err != nil {
+		return nil, err
+	}
+	window, err := newPointFilter(req.StepRange, req.WallTimeRange)
+	if err != nil {
+		return nil, err
+	}
 
-	for run, acc := range s.ll.Runs() {
+	for run, acc := range ll.Runs() {
 		if !matchesFilter(runFilter, run) {
 			continue
 		}
@@ -224,7 +455,7 @@ func (s *Server) ReadTensors(ctx context.Context, req *dppb.ReadTensorsRequest)
 			if !matchesFilter(tagFilter, tag) {
 				continue
 			}
-			sample := downsampleValueData(acc.Sample(tag), numPoints)
+			sample := downsampleValueData(window.apply(acc.Sample(tag)), numPoints)
 			data := dppb.TensorData{
 				Step:     make([]int64, len(sample)),
 				WallTime: make([]float64, len(sample)),
@@ -254,10 +485,17 @@ func (s *Server) ReadTensors(ctx context.Context, req *dppb.ReadTensorsRequest)
 
 // ListBlobSequences handles the ListBlobSequences RPC.
 func (s *Server) ListBlobSequences(ctx context.Context, req *dppb.ListBlobSequencesRequest) (*dppb.ListBlobSequencesResponse, error) {
+	ll, err := s.loader(req.ExperimentId)
+	if err != nil {
+		return nil, err
+	}
 	res := new(dppb.ListBlobSequencesResponse)
-	runFilter, tagFilter := filters(req.RunTagFilter)
+	runFilter, tagFilter, err := filters(req.RunTagFilter)
+	if err != nil {
+		return nil, err
+	}
 
-	for run, acc := range s.ll.Runs() {
+	for run, acc := range ll.Runs() {
 		if !matchesFilter(runFilter, run) {
 			continue
 		}
@@ -302,14 +540,28 @@ func (s *Server) ListBlobSequences(ctx context.Context, req *dppb.ListBlobSequen
 
 // ReadBlobSequences handles the ReadBlobSequences RPC.
 func (s *Server) ReadBlobSequences(ctx context.Context, req *dppb.ReadBlobSequencesRequest) (*dppb.ReadBlobSequencesResponse, error) {
+	ll, err := s.loader(req.ExperimentId)
+	if err != nil {
+		return nil, err
+	}
 	res := new(dppb.ReadBlobSequencesResponse)
-	runFilter, tagFilter := filters(req.RunTagFilter)
+	runFilter, tagFilter, err := filters(req.RunTagFilter)
+	if err != nil {
+		return nil, err
+	}
 	numPoints := int(req.Downsample.GetNumPoints())
 	if numPoints < 0 {
 		return nil, status.Errorf(codes.InvalidArgument, "downsample.num_points: want non-negative, got %v", numPoints)
 	}
+	if _, err := downsampleMethod(req.Downsample, dppb.Downsample_METHOD_SAMPLE); err != nil {
+		return nil, err
+	}
+	window, err := newPointFilter(req.StepRange, req.WallTimeRange)
+	if err != nil {
+		return nil, err
+	}
 
-	for run, acc := range s.ll.Runs() {
+	for run, acc := range ll.Runs() {
 		if !matchesFilter(runFilter, run) {
 			continue
 		}
@@ -324,13 +576,12 @@ func (s *Server) ReadBlobSequences(ctx context.Context, req *dppb.ReadBlobSequen
 			if !matchesFilter(tagFilter, tag) {
 				continue
 			}
-			sample := acc.Sample(tag)
+			sample := downsampleValueData(window.apply(acc.Sample(tag)), numPoints)
 			data := dppb.BlobSequenceData{
 				Step:     make([]int64, len(sample)),
 				WallTime: make([]float64, len(sample)),
 				Values:   make([]*dppb.BlobReferenceSequence, len(sample)),
 			}
-			// TODO(@wchargin): Re-downsample.
 			for i, x := range sample {
 				data.Step[i] = int64(x.EventStep)
 				data.WallTime[i] = x.EventWallTime
@@ -360,9 +611,12 @@ func (s *Server) ReadBlob(req *dppb.ReadBlobRequest, stream dppb.TensorBoardData
 		return status.Errorf(codes.InvalidArgument, "invalid blob key %q: %v", req.BlobKey, err)
 	}
 
-	_ = bk.eid
+	ll, err := s.loader(bk.eid)
+	if err != nil {
+		return err
+	}
 	var data []run.ValueDatum
-	if run := s.ll.Run(bk.run); run != nil {
+	if run := ll.Run(bk.run); run != nil {
 		data = run.Sample(bk.tag)
 	}
 	if data == nil {
@@ -398,32 +652,104 @@ func (s *Server) ReadBlob(req *dppb.ReadBlobRequest, stream dppb.TensorBoardData
 	return nil
 }
 
-// A stringFilter is a predicate for strings. If nil, it matches all strings.
-// Otherwise, it matches exactly those strings in the referenced slice.
-type stringFilter *[]string
+// ListLoadErrors handles the ListLoadErrors RPC. Only runs with at least one
+// load error are included, in lexicographic order of name.
+func (s *Server) ListLoadErrors(ctx context.Context, req *dppb.ListLoadErrorsRequest) (*dppb.ListLoadErrorsResponse, error) {
+	ll, err := s.loader(req.ExperimentId)
+	if err != nil {
+		return nil, err
+	}
+	res := new(dppb.ListLoadErrorsResponse)
+	runFilter, err := runsFilter("runs", req.Runs)
+	if err != nil {
+		return nil, err
+	}
 
-func matchesFilter(f stringFilter, x string) bool {
-	if f == nil {
-		return true
+	runs := ll.Runs()
+	var names []string
+	for run := range runs {
+		if matchesFilter(runFilter, run) {
+			names = append(names, run)
+		}
 	}
-	for _, y := range *f {
-		if x == y {
-			return true
+	sort.Strings(names)
+	for _, run := range names {
+		errs, total := runs[run].LoadErrors()
+		if total == 0 {
+			continue
+		}
+		e := &dppb.ListLoadErrorsResponse_RunEntry{
+			RunName:   run,
+			NumErrors: int64(total),
+			Errors:    make([]*dppb.LoadError, len(errs)),
+		}
+		for i, le := range errs {
+			e.Errors[i] = loadErrorProto(le)
 		}
+		res.Runs = append(res.Runs, e)
 	}
-	return false
+	return res, nil
 }
 
-// filters extracts two stringFilters from a *RunTagFilter, which may be nil.
-// The returned filters may point into rtf.
-func filters(rtf *dppb.RunTagFilter) (runs stringFilter, tags stringFilter) {
-	if rf := rtf.GetRuns(); rf != nil {
-		runs = &rf.Runs
+// GetLoadStatus handles the GetLoadStatus RPC.
+func (s *Server) GetLoadStatus(ctx context.Context, req *dppb.GetLoadStatusRequest) (*dppb.GetLoadStatusResponse, error) {
+	ll, err := s.loader(req.ExperimentId)
+	if err != nil {
+		return nil, err
+	}
+	st := ll.Status()
+	res := &dppb.GetLoadStatusResponse{
+		InitialLoadComplete:       st.Loaded,
+		LastReloadDurationSeconds: st.LastReloadDuration.Seconds(),
+		NumRuns:                   int64(len(st.Runs)),
+	}
+	if !st.LastReload.IsZero() {
+		res.LastReloadWallTime = float64(st.LastReload.UnixNano()) / 1e9
 	}
-	if tf := rtf.GetTags(); tf != nil {
-		tags = &tf.Tags
+	var names []string
+	for run := range st.Runs {
+		names = append(names, run)
+	}
+	sort.Strings(names)
+	for _, run := range names {
+		p := st.Runs[run]
+		res.NumFiles += int64(p.Files)
+		res.BytesRead += p.BytesRead
+		res.TotalBytes += p.TotalBytes
+		res.Runs = append(res.Runs, &dppb.GetLoadStatusResponse_RunEntry{
+			RunName:    run,
+			NumFiles:   int64(p.Files),
+			BytesRead:  p.BytesRead,
+			TotalBytes: p.TotalBytes,
+		})
+	}
+	return res, nil
+}
+
+// loadErrorProto converts a run.LoadError to its wire representation.
+func loadErrorProto(le run.LoadError) *dppb.LoadError {
+	var kind dppb.LoadError_Kind
+	switch le.Kind {
+	case run.LoadErrorIO:
+		kind = dppb.LoadError_KIND_IO
+	case run.LoadErrorDataLoss:
+		kind = dppb.LoadError_KIND_DATA_LOSS
+	case run.LoadErrorParse:
+		kind = dppb.LoadError_KIND_PARSE
+	case run.LoadErrorFatal:
+		kind = dppb.LoadError_KIND_FATAL
+	}
+	var msg string
+	if le.Err != nil {
+		msg = le.Err.Error()
+	}
+	return &dppb.LoadError{
+		File:     le.File,
+		Offset:   le.Offset,
+		Kind:     kind,
+		WallTime: float64(le.Time.UnixNano()) / 1e9,
+		Message:  msg,
 	}
-	return
 }
 
 // scalarValue gets the scalar data point associated with the given tensor,
@@ -464,6 +790,29 @@ func blobSequenceValues(eid string, run string, tag string, step mem.Step, tenso
 	return &dppb.BlobReferenceSequence{BlobRefs: refs}
 }
 
+// scalarData converts a sample of a scalar time series to its column-major
+// wire representation.
+func scalarData(sample []run.ValueDatum) *dppb.ScalarData {
+	data := &dppb.ScalarData{
+		Step:     make([]int64, len(sample)),
+		WallTime: make([]float64, len(sample)),
+		Value:    make([]float64, len(sample)),
+	}
+	for i, x := range sample {
+		data.Step[i] = int64(x.EventStep)
+		data.WallTime[i] = x.EventWallTime
+		data.Value[i] = scalarValue(x.Value.GetTensor())
+	}
+	return data
+}
+
+// valueDataAfter returns the suffix of a step-sorted sample containing only
+// points whose steps exceed the given step.
+func valueDataAfter(sample []run.ValueDatum, step mem.Step) []run.ValueDatum {
+	i := sort.Search(len(sample), func(i int) bool { return sample[i].EventStep > step })
+	return sample[i:]
+}
+
 func maxWallTime(ds []run.ValueDatum) float64 {
 	result := math.Inf(-1)
 	for _, d := range ds {
@@ -488,6 +837,40 @@ func maxLength(ds []run.ValueDatum) int64 {
 	return result
 }
 
+// lttbValueData downsamples a step-sorted sample of a scalar time series with
+// downsampleLTTB, plotting values against steps.
+func lttbValueData(sample []run.ValueDatum, k int) []run.ValueDatum {
+	dstSize := k
+	if dstSize > len(sample) {
+		dstSize = len(sample)
+	}
+	values := make([]float64, len(sample))
+	for i, x := range sample {
+		values[i] = scalarValue(x.Value.GetTensor())
+	}
+	dst := make([]run.ValueDatum, dstSize)
+	downsampleLTTB(
+		len(sample), dstSize,
+		func(i int) float64 { return float64(sample[i].EventStep) },
+		func(i int) float64 { return values[i] },
+		func(i, j int) { dst[j] = sample[i] },
+	)
+	return dst
+}
+
+// downsampleMethod gets the method of a Downsample, which may be nil, and
+// checks that it's one of the given supported methods. Errors have code
+// InvalidArgument.
+func downsampleMethod(ds *dppb.Downsample, supported ...dppb.Downsample_Method) (dppb.Downsample_Method, error) {
+	method := ds.GetMethod()
+	for _, m := range supported {
+		if method == m {
+			return method, nil
+		}
+	}
+	return method, status.Errorf(codes.InvalidArgument, "downsample.method: %v not supported for this RPC", method)
+}
+
 func downsampleValueData(sample []run.ValueDatum, k int) []run.ValueDatum {
 	dstSize := k
 	if dstSize > len(sample) {
@@ -1,11 +1,31 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	spb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/summary_go_proto"
 	tpb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/tensor_go_proto"
 	tspb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/tensor_shape_go_proto"
 	dtpb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/types_go_proto"
+	epb "github.com/tensorflow/tensorflow/tensorflow/go/core/util/event_go_proto"
+	"github.com/wchargin/tensorboard-data-server/fs"
+	tbio "github.com/wchargin/tensorboard-data-server/io"
+	"github.com/wchargin/tensorboard-data-server/io/logdir"
+	"github.com/wchargin/tensorboard-data-server/io/run"
+	dppb "github.com/wchargin/tensorboard-data-server/proto/data_provider_proto"
 )
 
 func TestScalarValueFloatVal(t *testing.T) {
@@ -51,3 +71,771 @@ func TestScalarValueDoubleBytes(t *testing.T) {
 		t.Errorf("scalarValue(%v): got %v, want %v", tensor, got, want)
 	}
 }
+
+func TestLoadErrorProto(t *testing.T) {
+	le := run.LoadError{
+		File:   "logs/train/events.out.tfevents.123",
+		Offset: 1024,
+		Kind:   run.LoadErrorDataLoss,
+		Time:   time.Unix(1234, 500000000),
+		Err:    errors.New("data CRC mismatch"),
+	}
+	got := loadErrorProto(le)
+	want := &dppb.LoadError{
+		File:     "logs/train/events.out.tfevents.123",
+		Offset:   1024,
+		Kind:     dppb.LoadError_KIND_DATA_LOSS,
+		WallTime: 1234.5,
+		Message:  "data CRC mismatch",
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("loadErrorProto(%+v): got %v, want %v", le, got, want)
+	}
+}
+
+// fakeWatchScalarsServer is a TensorBoardDataProvider_WatchScalarsServer that
+// forwards responses to a channel.
+type fakeWatchScalarsServer struct {
+	grpc.ServerStream
+	ctx       context.Context
+	responses chan *dppb.WatchScalarsResponse
+}
+
+func (s *fakeWatchScalarsServer) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeWatchScalarsServer) Send(res *dppb.WatchScalarsResponse) error {
+	s.responses <- res
+	return nil
+}
+
+// appendEvents appends events to an event file, creating it if needed.
+func appendEvents(t *testing.T, file string, events ...*epb.Event) {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, event := range events {
+		buf, err := proto.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record := tbio.NewTFRecord(buf)
+		if err := record.Write(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// summaryEvent creates an event with a single summary value.
+func summaryEvent(step int64, value *spb.Summary_Value) *epb.Event {
+	return &epb.Event{
+		Step:     step,
+		WallTime: float64(1000 + step),
+		What:     &epb.Event_Summary{Summary: &spb.Summary{Value: []*spb.Summary_Value{value}}},
+	}
+}
+
+// appendScalars appends scalar events for the given steps to an event file,
+// with tag "loss" and value equal to the step.
+func appendScalars(t *testing.T, file string, steps ...int64) {
+	var events []*epb.Event
+	for _, step := range steps {
+		value := &spb.Summary_Value{Tag: "loss", Value: &spb.Summary_Value_SimpleValue{SimpleValue: float32(step)}}
+		events = append(events, summaryEvent(step, value))
+	}
+	appendEvents(t, file, events...)
+}
+
+func TestListRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Runs are created out of lexical order. Each run's first event has
+	// wall time 1000 + step.
+	firstSteps := map[string]int64{"train": 20, "eval": 5, "test": 30}
+	for _, run := range []string{"train", "eval", "test"} {
+		if err := os.Mkdir(filepath.Join(dir, run), 0755); err != nil {
+			t.Fatal(err)
+		}
+		step := firstSteps[run]
+		appendScalars(t, filepath.Join(dir, run, "events.out.tfevents.123.myhost"), step, step+1, step+2)
+	}
+
+	ll := logdir.LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	defer ll.Close()
+	for run := range firstSteps {
+		reloadUntil(t, ll, run, 3, "loss")
+	}
+	s := NewServer(ll)
+
+	res, err := s.ListRuns(context.Background(), &dppb.ListRunsRequest{})
+	if err != nil {
+		t.Fatalf("ListRuns: %v", err)
+	}
+	want := []*dppb.Run{
+		{Id: "eval", Name: "eval", StartTime: 1005},
+		{Id: "test", Name: "test", StartTime: 1030},
+		{Id: "train", Name: "train", StartTime: 1020},
+	}
+	if len(res.Runs) != len(want) {
+		t.Fatalf("ListRuns: got %v, want %v", res.Runs, want)
+	}
+	for i := range want {
+		if !proto.Equal(res.Runs[i], want[i]) {
+			t.Errorf("ListRuns: run %d: got %v, want %v", i, res.Runs[i], want[i])
+		}
+	}
+}
+
+func TestWatchScalars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "train"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "train", "events.out.tfevents.123.myhost")
+	appendScalars(t, file, 0, 1, 2)
+
+	ll := logdir.LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	defer ll.Close()
+	s := NewServer(ll)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &fakeWatchScalarsServer{ctx: ctx, responses: make(chan *dppb.WatchScalarsResponse)}
+	req := &dppb.WatchScalarsRequest{
+		PluginFilter: &dppb.PluginFilter{PluginName: "scalars"},
+		LastSeen:     []*dppb.WatchScalarsRequest_LastSeen{{RunName: "train", TagName: "loss", Step: 0}},
+	}
+	done := make(chan error)
+	go func() { done <- s.WatchScalars(req, stream) }()
+
+	// next reloads the logdir until the watcher sends a response. Several
+	// reloads may be needed, since accumulators ingest asynchronously.
+	next := func() *dppb.WatchScalarsResponse {
+		deadline := time.After(5 * time.Second)
+		for {
+			ll.Reload(context.Background())
+			select {
+			case res := <-stream.responses:
+				return res
+			case <-time.After(10 * time.Millisecond):
+			case <-deadline:
+				t.Fatalf("no response after 5s")
+			}
+		}
+	}
+	wantSteps := func(res *dppb.WatchScalarsResponse, want []int64) {
+		t.Helper()
+		if len(res.Runs) != 1 || len(res.Runs[0].Tags) != 1 {
+			t.Fatalf("response: got %v, want one run with one tag", res)
+		}
+		run, tag := res.Runs[0], res.Runs[0].Tags[0]
+		if run.RunName != "train" || tag.TagName != "loss" {
+			t.Errorf("time series: got %q/%q, want %q/%q", run.RunName, tag.TagName, "train", "loss")
+		}
+		if got := tag.Data.Step; !reflect.DeepEqual(got, want) {
+			t.Errorf("steps: got %v, want %v", got, want)
+		}
+	}
+
+	wantSteps(next(), []int64{1, 2})
+	appendScalars(t, file, 3, 4)
+	wantSteps(next(), []int64{3, 4})
+
+	cancel()
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.Canceled {
+			t.Errorf("WatchScalars after cancel: got %v, want Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("WatchScalars: still running 5s after cancel")
+	}
+}
+
+func TestWatchScalarsReplace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "train"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "train", "events.out.tfevents.123.myhost")
+	appendScalars(t, file, 0, 1, 2, 3, 4)
+
+	ll := logdir.LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	defer ll.Close()
+	reloadUntil(t, ll, "train", 5, "loss")
+	s := NewServer(ll)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &fakeWatchScalarsServer{ctx: ctx, responses: make(chan *dppb.WatchScalarsResponse)}
+	req := &dppb.WatchScalarsRequest{
+		PluginFilter: &dppb.PluginFilter{PluginName: "scalars"},
+		Downsample:   &dppb.Downsample{NumPoints: 2, Method: dppb.Downsample_METHOD_LTTB},
+	}
+	go s.WatchScalars(req, stream)
+
+	tagEntry := func(res *dppb.WatchScalarsResponse) *dppb.WatchScalarsResponse_TagEntry {
+		t.Helper()
+		if len(res.Runs) != 1 || len(res.Runs[0].Tags) != 1 {
+			t.Fatalf("response: got %v, want one run with one tag", res)
+		}
+		return res.Runs[0].Tags[0]
+	}
+
+	// The initial snapshot is downsampled.
+	var initial *dppb.WatchScalarsResponse
+	select {
+	case initial = <-stream.responses:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no initial response after 5s")
+	}
+	if e := tagEntry(initial); !reflect.DeepEqual(e.Data.Step, []int64{0, 4}) || e.Replace {
+		t.Errorf("initial: got steps %v, replace %v; want [0 4], false", e.Data.Step, e.Replace)
+	}
+
+	// A restart from step 2 replaces the client's points, even though no
+	// new step exceeds step 4. The restarted points may be ingested over
+	// several reloads, so follow responses as a client would.
+	appendScalars(t, file, 2, 3)
+	var steps []int64
+	var replaced bool
+	deadline := time.After(5 * time.Second)
+	for len(steps) == 0 || steps[len(steps)-1] != 3 {
+		ll.Reload(context.Background())
+		select {
+		case res := <-stream.responses:
+			e := tagEntry(res)
+			if e.Replace {
+				if len(e.Data.Step) > 2 {
+					t.Errorf("replacement: got steps %v, want at most 2 points", e.Data.Step)
+				}
+				replaced = true
+				steps = nil
+			}
+			steps = append(steps, e.Data.Step...)
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("no response with step 3 after 5s; got steps %v", steps)
+		}
+	}
+	if !replaced {
+		t.Errorf("after restart: got no replacement, want one")
+	}
+	for i := 1; i < len(steps); i++ {
+		if steps[i-1] >= steps[i] {
+			t.Errorf("after restart: got steps %v, want increasing", steps)
+			break
+		}
+	}
+}
+
+func TestWatchScalarsOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	runs := []string{"train", "eval", "test"}
+	tags := []string{"loss", "accuracy", "lr"}
+	for _, run := range runs {
+		if err := os.Mkdir(filepath.Join(dir, run), 0755); err != nil {
+			t.Fatal(err)
+		}
+		var events []*epb.Event
+		for _, tag := range tags {
+			events = append(events, summaryEvent(0, &spb.Summary_Value{Tag: tag, Value: &spb.Summary_Value_SimpleValue{SimpleValue: 1}}))
+		}
+		appendEvents(t, filepath.Join(dir, run, "events.out.tfevents.123.myhost"), events...)
+	}
+
+	ll := logdir.LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	defer ll.Close()
+	for _, run := range runs {
+		reloadUntil(t, ll, run, 1, tags...)
+	}
+	s := NewServer(ll)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &fakeWatchScalarsServer{ctx: ctx, responses: make(chan *dppb.WatchScalarsResponse, 1)}
+	req := &dppb.WatchScalarsRequest{PluginFilter: &dppb.PluginFilter{PluginName: "scalars"}}
+	go s.WatchScalars(req, stream)
+	var res *dppb.WatchScalarsResponse
+	select {
+	case res = <-stream.responses:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no response after 5s")
+	}
+
+	var got []string
+	for _, run := range res.Runs {
+		for _, tag := range run.Tags {
+			got = append(got, run.RunName+"/"+tag.TagName)
+		}
+	}
+	want := []string{
+		"eval/accuracy", "eval/loss", "eval/lr",
+		"test/accuracy", "test/loss", "test/lr",
+		"train/accuracy", "train/loss", "train/lr",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("time series: got %v, want %v", got, want)
+	}
+}
+
+// reloadUntil reloads ll until the given run has n points for each given tag.
+// Several reloads may be needed, since accumulators ingest asynchronously.
+func reloadUntil(t *testing.T, ll *logdir.Loader, run string, n int, tags ...string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ll.Reload(context.Background())
+		ready := true
+		if acc := ll.Run(run); acc == nil {
+			ready = false
+		} else {
+			for _, tag := range tags {
+				if len(acc.Sample(tag)) < n {
+					ready = false
+				}
+			}
+		}
+		if ready {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %q: tags %v not loaded after 5s", run, tags)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadDownsample(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "train"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "train", "events.out.tfevents.123.myhost")
+
+	const numSteps = 8 // fits in all default reservoirs
+	appendScalars(t, file, 0, 1, 2, 3, 4, 5, 6, 7)
+	for step := int64(0); step < numSteps; step++ {
+		histogram := &spb.Summary_Value{
+			Tag: "weights",
+			Value: &spb.Summary_Value_Tensor{Tensor: &tpb.TensorProto{
+				Dtype:       dtpb.DataType_DT_DOUBLE,
+				TensorShape: &tspb.TensorShapeProto{Dim: []*tspb.TensorShapeProto_Dim{{Size: 1}, {Size: 3}}},
+				DoubleVal:   []float64{0.0, 1.0, float64(step)},
+			}},
+		}
+		if step == 0 {
+			histogram.Metadata = &spb.SummaryMetadata{
+				PluginData: &spb.SummaryMetadata_PluginData{PluginName: "histograms"},
+			}
+		}
+		image := &spb.Summary_Value{
+			Tag: "input",
+			Value: &spb.Summary_Value_Image{Image: &spb.Summary_Image{
+				Height:             1,
+				Width:              1,
+				EncodedImageString: []byte("\x89PNG"),
+			}},
+		}
+		appendEvents(t, file, summaryEvent(step, histogram), summaryEvent(step, image))
+	}
+
+	ll := logdir.LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	defer ll.Close()
+	reloadUntil(t, ll, "train", numSteps, "loss", "weights", "input")
+	s := NewServer(ll)
+	ctx := context.Background()
+
+	// Each read function calls an RPC with the given num_points and
+	// returns the steps for the only time series in the response.
+	reads := []struct {
+		name string
+		read func(numPoints int64) ([]int64, error)
+	}{
+		{"ReadScalars", func(numPoints int64) ([]int64, error) {
+			res, err := s.ReadScalars(ctx, &dppb.ReadScalarsRequest{
+				PluginFilter: &dppb.PluginFilter{PluginName: "scalars"},
+				Downsample:   &dppb.Downsample{NumPoints: numPoints},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(res.Runs) != 1 || len(res.Runs[0].Tags) != 1 {
+				return nil, fmt.Errorf("got %v, want one time series", res)
+			}
+			return res.Runs[0].Tags[0].Data.Step, nil
+		}},
+		{"ReadTensors", func(numPoints int64) ([]int64, error) {
+			res, err := s.ReadTensors(ctx, &dppb.ReadTensorsRequest{
+				PluginFilter: &dppb.PluginFilter{PluginName: "histograms"},
+				Downsample:   &dppb.Downsample{NumPoints: numPoints},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(res.Runs) != 1 || len(res.Runs[0].Tags) != 1 {
+				return nil, fmt.Errorf("got %v, want one time series", res)
+			}
+			return res.Runs[0].Tags[0].Data.Step, nil
+		}},
+		{"ReadBlobSequences", func(numPoints int64) ([]int64, error) {
+			res, err := s.ReadBlobSequences(ctx, &dppb.ReadBlobSequencesRequest{
+				PluginFilter: &dppb.PluginFilter{PluginName: "images"},
+				Downsample:   &dppb.Downsample{NumPoints: numPoints},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(res.Runs) != 1 || len(res.Runs[0].Tags) != 1 {
+				return nil, fmt.Errorf("got %v, want one time series", res)
+			}
+			data := res.Runs[0].Tags[0].Data
+			if len(data.Values) != len(data.Step) {
+				return nil, fmt.Errorf("got %v values for %v steps", len(data.Values), len(data.Step))
+			}
+			return data.Step, nil
+		}},
+	}
+
+	for _, r := range reads {
+		for _, numPoints := range []int64{0, 1, 3, numSteps, 100} {
+			steps, err := r.read(numPoints)
+			if err != nil {
+				t.Errorf("%s(num_points=%v): %v", r.name, numPoints, err)
+				continue
+			}
+			wantLen := int(numPoints)
+			if wantLen > numSteps {
+				wantLen = numSteps
+			}
+			if len(steps) != wantLen {
+				t.Errorf("%s(num_points=%v): got steps %v, want %v of them", r.name, numPoints, steps, wantLen)
+				continue
+			}
+			if wantLen > 0 && steps[len(steps)-1] != numSteps-1 {
+				t.Errorf("%s(num_points=%v): got steps %v, want last step %v", r.name, numPoints, steps, numSteps-1)
+			}
+			for i := 1; i < len(steps); i++ {
+				if steps[i] <= steps[i-1] {
+					t.Errorf("%s(num_points=%v): got steps %v, want increasing", r.name, numPoints, steps)
+					break
+				}
+			}
+		}
+
+		if _, err := r.read(-1); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s(num_points=-1): got %v, want InvalidArgument", r.name, err)
+		}
+	}
+}
+
+func TestReadWindow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "train"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	const numSteps = 100
+	var steps []int64
+	for step := int64(0); step < numSteps; step++ {
+		steps = append(steps, step)
+	}
+	appendScalars(t, filepath.Join(dir, "train", "events.out.tfevents.123.myhost"), steps...)
+
+	ll := logdir.LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	defer ll.Close()
+	reloadUntil(t, ll, "train", numSteps, "loss")
+	s := NewServer(ll)
+	ctx := context.Background()
+
+	// Wall times are 1000 plus the step. Each case reads 5 points, which
+	// should all come from the window, and include its last point.
+	cases := []struct {
+		name     string
+		sr       *dppb.StepRange
+		wtr      *dppb.WallTimeRange
+		min, max int64 // steps
+		wantLen  int
+	}{
+		{"step range", &dppb.StepRange{MinStep: 90, MaxStep: 200}, nil, 90, 99, 5},
+		{"wall time range", nil, &dppb.WallTimeRange{MinWallTime: 1010, MaxWallTime: 1012.5}, 10, 12, 3},
+		{"both", &dppb.StepRange{MinStep: 0, MaxStep: 50}, &dppb.WallTimeRange{MinWallTime: 1040, MaxWallTime: 1090}, 40, 50, 5},
+		{"empty", &dppb.StepRange{MinStep: 200, MaxStep: 300}, nil, 0, 0, 0},
+	}
+	for _, c := range cases {
+		res, err := s.ReadScalars(ctx, &dppb.ReadScalarsRequest{
+			PluginFilter:  &dppb.PluginFilter{PluginName: "scalars"},
+			Downsample:    &dppb.Downsample{NumPoints: 5},
+			StepRange:     c.sr,
+			WallTimeRange: c.wtr,
+		})
+		if err != nil {
+			t.Errorf("%s: ReadScalars: %v", c.name, err)
+			continue
+		}
+		if len(res.Runs) != 1 || len(res.Runs[0].Tags) != 1 {
+			t.Errorf("%s: got %v, want one time series", c.name, res)
+			continue
+		}
+		got := res.Runs[0].Tags[0].Data.Step
+		if len(got) != c.wantLen {
+			t.Errorf("%s: got steps %v, want %v of them", c.name, got, c.wantLen)
+			continue
+		}
+		if len(got) > 0 && got[len(got)-1] != c.max {
+			t.Errorf("%s: got steps %v, want last step %v", c.name, got, c.max)
+		}
+		for _, step := range got {
+			if step < c.min || step > c.max {
+				t.Errorf("%s: got steps %v, want all in [%v, %v]", c.name, got, c.min, c.max)
+				break
+			}
+		}
+	}
+
+	_, err = s.ReadTensors(ctx, &dppb.ReadTensorsRequest{
+		Downsample: &dppb.Downsample{NumPoints: 5},
+		StepRange:  &dppb.StepRange{MinStep: 2, MaxStep: 1},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ReadTensors with bad step_range: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestReadScalarsMethods(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "train"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A spike at step 5 should survive both aggregation and LTTB.
+	file := filepath.Join(dir, "train", "events.out.tfevents.123.myhost")
+	appendScalars(t, file, 0, 1, 2, 3, 4)
+	appendEvents(t, file, summaryEvent(5, &spb.Summary_Value{Tag: "loss", Value: &spb.Summary_Value_SimpleValue{SimpleValue: 1000}}))
+	appendScalars(t, file, 6, 7, 8, 9)
+
+	ll := logdir.LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	defer ll.Close()
+	reloadUntil(t, ll, "train", 10, "loss")
+	s := NewServer(ll)
+	ctx := context.Background()
+
+	res, err := s.ReadScalars(ctx, &dppb.ReadScalarsRequest{
+		PluginFilter: &dppb.PluginFilter{PluginName: "scalars"},
+		Downsample:   &dppb.Downsample{NumPoints: 2, Method: dppb.Downsample_METHOD_AGGREGATE},
+	})
+	if err != nil {
+		t.Fatalf("ReadScalars: %v", err)
+	}
+	if len(res.Runs) != 1 || len(res.Runs[0].Tags) != 1 {
+		t.Fatalf("ReadScalars: got %v, want one time series", res)
+	}
+	data := res.Runs[0].Tags[0].Data
+	if want := []int64{4, 9}; !int64SlicesEqual(data.Step, want) {
+		t.Errorf("steps: got %v, want %v", data.Step, want)
+	}
+	if want := []float64{4, 1000}; !reflect.DeepEqual(data.Max, want) {
+		t.Errorf("maxes: got %v, want %v", data.Max, want)
+	}
+
+	res, err = s.ReadScalars(ctx, &dppb.ReadScalarsRequest{
+		PluginFilter: &dppb.PluginFilter{PluginName: "scalars"},
+		Downsample:   &dppb.Downsample{NumPoints: 3, Method: dppb.Downsample_METHOD_LTTB},
+	})
+	if err != nil {
+		t.Fatalf("ReadScalars: %v", err)
+	}
+	if len(res.Runs) != 1 || len(res.Runs[0].Tags) != 1 {
+		t.Fatalf("ReadScalars: got %v, want one time series", res)
+	}
+	data = res.Runs[0].Tags[0].Data
+	if want := []int64{0, 5, 9}; !int64SlicesEqual(data.Step, want) {
+		t.Errorf("LTTB steps: got %v, want %v", data.Step, want)
+	}
+	if len(data.Min) != 0 {
+		t.Errorf("LTTB mins: got %v, want empty", data.Min)
+	}
+
+	_, err = s.ReadTensors(ctx, &dppb.ReadTensorsRequest{
+		Downsample: &dppb.Downsample{NumPoints: 2, Method: dppb.Downsample_METHOD_AGGREGATE},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ReadTensors with METHOD_AGGREGATE: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestWatchScalarsShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ll := logdir.LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	defer ll.Close()
+	s := NewServer(ll)
+
+	stream := &fakeWatchScalarsServer{ctx: context.Background(), responses: make(chan *dppb.WatchScalarsResponse)}
+	done := make(chan error)
+	go func() { done <- s.WatchScalars(&dppb.WatchScalarsRequest{}, stream) }()
+	s.Shutdown()
+	s.Shutdown() // should be idempotent
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.Unavailable {
+			t.Errorf("WatchScalars after Shutdown: got %v, want Unavailable", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("WatchScalars: still running 5s after Shutdown")
+	}
+}
+
+func TestMultiServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	lls := make(map[string]*logdir.Loader)
+	for eid, run := range map[string]string{"mnist": "train", "cifar": "eval"} {
+		if err := os.MkdirAll(filepath.Join(dir, eid, run), 0755); err != nil {
+			t.Fatal(err)
+		}
+		appendScalars(t, filepath.Join(dir, eid, run, "events.out.tfevents.123.myhost"), 0)
+		ll := logdir.LoaderBuilder{FS: fs.OS{}, Logdir: filepath.Join(dir, eid)}.Start()
+		defer ll.Close()
+		reloadUntil(t, ll, run, 1, "loss")
+		lls[eid] = ll
+	}
+	s := NewMultiServer(lls)
+	ctx := context.Background()
+
+	for eid, want := range map[string]string{"mnist": "train", "cifar": "eval"} {
+		res, err := s.ListRuns(ctx, &dppb.ListRunsRequest{ExperimentId: eid})
+		if err != nil {
+			t.Errorf("ListRuns(%q): %v", eid, err)
+			continue
+		}
+		if len(res.Runs) != 1 || res.Runs[0].Name != want {
+			t.Errorf("ListRuns(%q): got %v, want one run %q", eid, res.Runs, want)
+		}
+	}
+	if _, err := s.ListRuns(ctx, &dppb.ListRunsRequest{ExperimentId: "imagenet"}); status.Code(err) != codes.NotFound {
+		t.Errorf("ListRuns(unknown experiment): got %v, want NotFound", err)
+	}
+	scalarsReq := &dppb.ReadScalarsRequest{ExperimentId: "imagenet", Downsample: &dppb.Downsample{NumPoints: 1}}
+	if _, err := s.ReadScalars(ctx, scalarsReq); status.Code(err) != codes.NotFound {
+		t.Errorf("ReadScalars(unknown experiment): got %v, want NotFound", err)
+	}
+
+	// Blob keys are resolved against the experiment that minted them.
+	blobKeys := []*blobKey{
+		{eid: "imagenet", run: "train", tag: "loss"},
+		{eid: "cifar", run: "train", tag: "loss"},
+	}
+	for _, bk := range blobKeys {
+		req := &dppb.ReadBlobRequest{BlobKey: string(bk.encode())}
+		if err := s.ReadBlob(req, nil); status.Code(err) != codes.NotFound {
+			t.Errorf("ReadBlob(%+v): got %v, want NotFound", bk, err)
+		}
+	}
+}
+
+func TestGetLoadStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, run := range []string{"train", "eval"} {
+		if err := os.Mkdir(filepath.Join(dir, run), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appendScalars(t, filepath.Join(dir, "train", "events.out.tfevents.123.myhost"), 0, 1, 2)
+	appendScalars(t, filepath.Join(dir, "train", "events.out.tfevents.456.myhost"), 3)
+	appendScalars(t, filepath.Join(dir, "eval", "events.out.tfevents.123.myhost"), 0)
+
+	ll := logdir.LoaderBuilder{FS: fs.OS{}, Logdir: dir}.Start()
+	defer ll.Close()
+	s := NewServer(ll)
+	ctx := context.Background()
+
+	res, err := s.GetLoadStatus(ctx, &dppb.GetLoadStatusRequest{})
+	if err != nil {
+		t.Fatalf("GetLoadStatus before load: %v", err)
+	}
+	if res.InitialLoadComplete || res.LastReloadWallTime != 0 || res.NumRuns != 0 {
+		t.Errorf("GetLoadStatus before load: got %v, want incomplete with no runs", res)
+	}
+
+	before := time.Now()
+	ll.Reload(context.Background())
+	select {
+	case <-ll.Loaded():
+	default:
+		t.Errorf("Loaded(): still open after Reload")
+	}
+	res, err = s.GetLoadStatus(ctx, &dppb.GetLoadStatusRequest{})
+	if err != nil {
+		t.Fatalf("GetLoadStatus after load: %v", err)
+	}
+	if !res.InitialLoadComplete {
+		t.Errorf("InitialLoadComplete: got false, want true")
+	}
+	if got, want := res.LastReloadWallTime, float64(before.UnixNano())/1e9; got < want {
+		t.Errorf("LastReloadWallTime: got %v, want at least %v", got, want)
+	}
+	if res.LastReloadDurationSeconds <= 0 {
+		t.Errorf("LastReloadDurationSeconds: got %v, want positive", res.LastReloadDurationSeconds)
+	}
+	if got, want := res.NumRuns, int64(2); got != want {
+		t.Errorf("NumRuns: got %v, want %v", got, want)
+	}
+	if got, want := res.NumFiles, int64(3); got != want {
+		t.Errorf("NumFiles: got %v, want %v", got, want)
+	}
+	if res.BytesRead != res.TotalBytes || res.TotalBytes == 0 {
+		t.Errorf("bytes: got %v of %v, want all of nonzero total", res.BytesRead, res.TotalBytes)
+	}
+	var names []string
+	for _, run := range res.Runs {
+		names = append(names, run.RunName)
+		info, err := os.Stat(filepath.Join(dir, run.RunName, "events.out.tfevents.123.myhost"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.RunName == "eval" && (run.NumFiles != 1 || run.BytesRead != info.Size() || run.TotalBytes != info.Size()) {
+			t.Errorf("eval: got %v, want one file read fully, of size %v", run, info.Size())
+		}
+	}
+	if want := []string{"eval", "train"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("runs: got %v, want %v", names, want)
+	}
+}
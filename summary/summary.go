@@ -0,0 +1,168 @@
+// Package summary creates summary values in the formats that TensorBoard
+// plugins expect, for writing to event files. Each function returns a
+// Summary.Value with a tensor and full summary metadata, including data class,
+// as written by TensorFlow 2.
+package summary
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+
+	spb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/summary_go_proto"
+	tpb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/tensor_go_proto"
+	tspb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/tensor_shape_go_proto"
+	dtpb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/types_go_proto"
+)
+
+// TensorBoard plugin names; must agree with the `PLUGIN_NAME`s defined in
+// `tensorboard.plugin.*.metadata`.
+const (
+	histogramsPluginName = "histograms"
+	imagesPluginName     = "images"
+	scalarsPluginName    = "scalars"
+	textPluginName       = "text"
+)
+
+// DefaultBucketCount is the number of histogram buckets used when Histogram is
+// given a bucket count of zero. It matches TensorBoard's default.
+const DefaultBucketCount = 30
+
+func metadata(pluginName string, dc spb.DataClass) *spb.SummaryMetadata {
+	return &spb.SummaryMetadata{
+		PluginData: &spb.SummaryMetadata_PluginData{PluginName: pluginName},
+		DataClass:  dc,
+	}
+}
+
+func shape(dims ...int64) *tspb.TensorShapeProto {
+	result := &tspb.TensorShapeProto{}
+	for _, d := range dims {
+		result.Dim = append(result.Dim, &tspb.TensorShapeProto_Dim{Size: d})
+	}
+	return result
+}
+
+func tensorValue(tag string, md *spb.SummaryMetadata, tensor *tpb.TensorProto) *spb.Summary_Value {
+	return &spb.Summary_Value{
+		Tag:      tag,
+		Metadata: md,
+		Value:    &spb.Summary_Value_Tensor{Tensor: tensor},
+	}
+}
+
+// Scalar creates a summary value for the scalars plugin: a rank-0 DT_DOUBLE
+// tensor.
+func Scalar(tag string, value float64) *spb.Summary_Value {
+	tensor := &tpb.TensorProto{
+		Dtype:       dtpb.DataType_DT_DOUBLE,
+		TensorShape: shape(),
+		DoubleVal:   []float64{value},
+	}
+	return tensorValue(tag, metadata(scalarsPluginName, spb.DataClass_DATA_CLASS_SCALAR), tensor)
+}
+
+// Histogram creates a summary value for the histograms plugin: a DT_DOUBLE
+// tensor of shape [k, 3] whose rows are the left edge, right edge, and count
+// of each bucket, in increasing order. The buckets evenly divide the range of
+// the data, or are a single bucket of width 1 if all data are equal, or are
+// empty if there are no data. A bucket count of zero means to use
+// DefaultBucketCount. NaN and infinite values are ignored.
+func Histogram(tag string, data []float64, bucketCount int) *spb.Summary_Value {
+	if bucketCount <= 0 {
+		bucketCount = DefaultBucketCount
+	}
+	buckets := histogramBuckets(data, bucketCount)
+	tensor := &tpb.TensorProto{
+		Dtype:       dtpb.DataType_DT_DOUBLE,
+		TensorShape: shape(int64(len(buckets)/3), 3),
+		DoubleVal:   buckets,
+	}
+	return tensorValue(tag, metadata(histogramsPluginName, spb.DataClass_DATA_CLASS_TENSOR), tensor)
+}
+
+// histogramBuckets computes the row-major contents of a histogram tensor.
+func histogramBuckets(data []float64, bucketCount int) []float64 {
+	var finite []float64
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, x := range data {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			continue
+		}
+		finite = append(finite, x)
+		min = math.Min(min, x)
+		max = math.Max(max, x)
+	}
+	if len(finite) == 0 {
+		return nil
+	}
+	if min == max {
+		return []float64{min - 0.5, max + 0.5, float64(len(finite))}
+	}
+
+	// Work with half-values so that max - min can't overflow, even when
+	// the data span nearly the whole range of float64.
+	halfSpan := max/2 - min/2
+	counts := make([]float64, bucketCount)
+	for _, x := range finite {
+		i := int((x/2 - min/2) / halfSpan * float64(bucketCount))
+		if i < 0 {
+			i = 0 // rounding error, or halfSpan underflowed
+		}
+		if i >= bucketCount {
+			i = bucketCount - 1 // x == max, or rounding error
+		}
+		counts[i]++
+	}
+	// Interpolate the edges as weighted sums of min and max, which are
+	// always finite.
+	edge := func(i int) float64 {
+		t := float64(i) / float64(bucketCount)
+		return min*(1-t) + max*t
+	}
+	result := make([]float64, 3*bucketCount)
+	for i, count := range counts {
+		right := edge(i + 1)
+		if i == bucketCount-1 {
+			right = max
+		}
+		result[3*i+0] = edge(i)
+		result[3*i+1] = right
+		result[3*i+2] = count
+	}
+	return result
+}
+
+// Image creates a summary value for the images plugin from a single image,
+// encoded as PNG: a DT_STRING tensor of shape [3] holding the width and height
+// as decimal strings followed by the encoded image.
+func Image(tag string, img image.Image) (*spb.Summary_Value, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	tensor := &tpb.TensorProto{
+		Dtype:       dtpb.DataType_DT_STRING,
+		TensorShape: shape(3),
+		StringVal: [][]byte{
+			[]byte(fmt.Sprintf("%d", bounds.Dx())),
+			[]byte(fmt.Sprintf("%d", bounds.Dy())),
+			buf.Bytes(),
+		},
+	}
+	return tensorValue(tag, metadata(imagesPluginName, spb.DataClass_DATA_CLASS_BLOB_SEQUENCE), tensor), nil
+}
+
+// Text creates a summary value for the text plugin: a rank-0 DT_STRING tensor.
+// The text plugin renders the string as Markdown.
+func Text(tag string, text string) *spb.Summary_Value {
+	tensor := &tpb.TensorProto{
+		Dtype:       dtpb.DataType_DT_STRING,
+		TensorShape: shape(),
+		StringVal:   [][]byte{[]byte(text)},
+	}
+	return tensorValue(tag, metadata(textPluginName, spb.DataClass_DATA_CLASS_TENSOR), tensor)
+}
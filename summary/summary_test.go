@@ -0,0 +1,227 @@
+package summary
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	spb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/summary_go_proto"
+	tpb "github.com/tensorflow/tensorflow/tensorflow/go/core/framework/tensor_go_proto"
+	epb "github.com/tensorflow/tensorflow/tensorflow/go/core/util/event_go_proto"
+	"github.com/wchargin/tensorboard-data-server/mem"
+)
+
+// readBack passes v through the same data compatibility layer that the server
+// uses on read, and returns the resulting value.
+func readBack(t *testing.T, v *spb.Summary_Value) *spb.Summary_Value {
+	t.Helper()
+	e := &epb.Event{
+		Step:     1,
+		WallTime: 1234.5,
+		What:     &epb.Event_Summary{Summary: &spb.Summary{Value: []*spb.Summary_Value{proto.Clone(v).(*spb.Summary_Value)}}},
+	}
+	values := mem.EventValues(e, make(mem.MetadataStore))
+	if len(values) != 1 {
+		t.Fatalf("EventValues(%v): got %v, want one value", e, values)
+	}
+	return values[0]
+}
+
+// checkReadBack checks that v is unchanged by the data compatibility layer
+// and has the given plugin name and data class, and returns its tensor.
+func checkReadBack(t *testing.T, v *spb.Summary_Value, pluginName string, dc spb.DataClass) *tpb.TensorProto {
+	t.Helper()
+	got := readBack(t, v)
+	if !proto.Equal(got, v) {
+		t.Errorf("read back: got %v, want unchanged %v", got, v)
+	}
+	if got, want := got.GetMetadata().GetPluginData().GetPluginName(), pluginName; got != want {
+		t.Errorf("plugin name: got %q, want %q", got, want)
+	}
+	if got, want := got.GetMetadata().GetDataClass(), dc; got != want {
+		t.Errorf("data class: got %v, want %v", got, want)
+	}
+	return got.GetTensor()
+}
+
+func TestScalar(t *testing.T) {
+	v := Scalar("loss", 0.125)
+	if got, want := v.Tag, "loss"; got != want {
+		t.Errorf("tag: got %q, want %q", got, want)
+	}
+	tensor := checkReadBack(t, v, "scalars", spb.DataClass_DATA_CLASS_SCALAR)
+	if got := len(tensor.GetTensorShape().GetDim()); got != 0 {
+		t.Errorf("rank: got %v, want 0", got)
+	}
+	if got, want := tensor.GetDoubleVal(), []float64{0.125}; !float64sEqual(got, want) {
+		t.Errorf("value: got %v, want %v", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []float64
+		bucketCount int
+		want        []float64
+	}{
+		{
+			name:        "even",
+			data:        []float64{0, 1, 2, 3},
+			bucketCount: 3,
+			want:        []float64{0, 1, 1, 1, 2, 1, 2, 3, 2},
+		},
+		{
+			name:        "skewed",
+			data:        []float64{-1, -1, -0.5, 1},
+			bucketCount: 4,
+			want:        []float64{-1, -0.5, 2, -0.5, 0, 1, 0, 0.5, 0, 0.5, 1, 1},
+		},
+		{
+			name:        "singular",
+			data:        []float64{5, 5, 5},
+			bucketCount: 10,
+			want:        []float64{4.5, 5.5, 3},
+		},
+		{
+			name:        "nonFinite",
+			data:        []float64{math.NaN(), 2, math.Inf(1), math.Inf(-1)},
+			bucketCount: 10,
+			want:        []float64{1.5, 2.5, 1},
+		},
+		{
+			name:        "extremeRange",
+			data:        []float64{-1e308, 1e308},
+			bucketCount: 2,
+			want:        []float64{-1e308, 0, 1, 0, 1e308, 1},
+		},
+		{
+			name:        "fullRange",
+			data:        []float64{-math.MaxFloat64, 0, math.MaxFloat64},
+			bucketCount: 1,
+			want:        []float64{-math.MaxFloat64, math.MaxFloat64, 3},
+		},
+		{
+			name:        "empty",
+			data:        nil,
+			bucketCount: 10,
+			want:        nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := Histogram("weights", test.data, test.bucketCount)
+			tensor := checkReadBack(t, v, "histograms", spb.DataClass_DATA_CLASS_TENSOR)
+			dims := tensor.GetTensorShape().GetDim()
+			if len(dims) != 2 || dims[0].Size != int64(len(test.want)/3) || dims[1].Size != 3 {
+				t.Errorf("shape: got %v, want [%v, 3]", dims, len(test.want)/3)
+			}
+			if got := tensor.GetDoubleVal(); !float64sEqual(got, test.want) {
+				t.Errorf("buckets: got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHistogramDefaultBucketCount(t *testing.T) {
+	var data []float64
+	for i := 0; i < 100; i++ {
+		data = append(data, float64(i))
+	}
+	v := Histogram("weights", data, 0)
+	if got, want := v.GetTensor().GetTensorShape().GetDim()[0].Size, int64(DefaultBucketCount); got != want {
+		t.Errorf("bucket count: got %v, want %v", got, want)
+	}
+	var total float64
+	buckets := v.GetTensor().GetDoubleVal()
+	for i := 0; i < len(buckets); i += 3 {
+		total += buckets[i+2]
+	}
+	if got, want := total, float64(len(data)); got != want {
+		t.Errorf("total count: got %v, want %v", got, want)
+	}
+}
+
+// TestHistogramMatchesLegacy checks that a histogram has the same tensor
+// layout as a legacy histogram proto with the same buckets after migration.
+func TestHistogramMatchesLegacy(t *testing.T) {
+	v := Histogram("weights", []float64{0, 1, 2, 3}, 3)
+	legacy := readBack(t, &spb.Summary_Value{
+		Tag: "weights",
+		Value: &spb.Summary_Value_Histo{Histo: &spb.HistogramProto{
+			Min:         0,
+			Max:         3,
+			BucketLimit: []float64{1, 2, 3},
+			Bucket:      []float64{1, 1, 2},
+		}},
+	})
+	if got, want := v.GetTensor(), legacy.GetTensor(); !proto.Equal(got, want) {
+		t.Errorf("tensor: got %v, want %v", got, want)
+	}
+	if got, want := v.GetMetadata(), legacy.GetMetadata(); !proto.Equal(got, want) {
+		t.Errorf("metadata: got %v, want %v", got, want)
+	}
+}
+
+func TestImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	v, err := Image("input", img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tensor := checkReadBack(t, v, "images", spb.DataClass_DATA_CLASS_BLOB_SEQUENCE)
+	bufs := tensor.GetStringVal()
+	if len(bufs) != 3 {
+		t.Fatalf("blobs: got %v, want width, height, and image", len(bufs))
+	}
+	if got, want := string(bufs[0]), "3"; got != want {
+		t.Errorf("width: got %q, want %q", got, want)
+	}
+	if got, want := string(bufs[1]), "2"; got != want {
+		t.Errorf("height: got %q, want %q", got, want)
+	}
+	decoded, err := png.Decode(bytes.NewReader(bufs[2]))
+	if err != nil {
+		t.Fatalf("decoding image: %v", err)
+	}
+	if got, want := decoded.Bounds(), img.Bounds(); got != want {
+		t.Errorf("bounds: got %v, want %v", got, want)
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			if got, want := color.RGBAModel.Convert(decoded.At(x, y)), img.At(x, y); got != want {
+				t.Errorf("pixel (%v, %v): got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	v := Text("notes", "# Hello\n\n*world*")
+	tensor := checkReadBack(t, v, "text", spb.DataClass_DATA_CLASS_TENSOR)
+	if got := len(tensor.GetTensorShape().GetDim()); got != 0 {
+		t.Errorf("rank: got %v, want 0", got)
+	}
+	bufs := tensor.GetStringVal()
+	if len(bufs) != 1 || string(bufs[0]) != "# Hello\n\n*world*" {
+		t.Errorf("value: got %q, want one string", bufs)
+	}
+}
+
+func float64sEqual(xs, ys []float64) bool {
+	if len(xs) != len(ys) {
+		return false
+	}
+	for i := range xs {
+		if xs[i] != ys[i] {
+			return false
+		}
+	}
+	return true
+}